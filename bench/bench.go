@@ -0,0 +1,168 @@
+// Package bench replays editing traces against every editors.Editor backend so
+// they can be compared on the same work: loading a file, typing, pasting,
+// deleting lines and scrolling through the text.
+//
+// The benchmarks in this package run them under go test, cmd/editbench runs
+// them all and prints a comparison table.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+// Backend is an Editor implementation to compare.
+type Backend struct {
+	Name string
+	New  func() editors.Editor
+}
+
+var Backends = []Backend{
+	{"DirtSimple", editors.NewDirtSimpleEditor},
+	{"PieceTable", editors.NewPieceTableEditor},
+	{"Rope", editors.NewRopeEditor},
+}
+
+// Size is the size of the file a trace works on.
+type Size struct {
+	Name  string
+	Bytes int
+}
+
+var Sizes = []Size{
+	{"1KB", 1 << 10},
+	{"1MB", 1 << 20},
+	{"100MB", 100 << 20},
+}
+
+// Trace is a kind of editing work.  Op does one unit of it, a keystroke or a
+// page of scrolling, to an editor holding lines.
+type Trace struct {
+	Name string
+	Op   func(e editors.Editor, rnd *rand.Rand)
+}
+
+// The Load trace is special, its op is loading the whole file into an empty
+// editor.
+const Load = "load"
+
+var Traces = []Trace{
+	{Load, nil},
+	{"typing", typing},
+	{"paste", paste},
+	{"deleteline", deleteLine},
+	{"scroll", scroll},
+}
+
+var style = tcell.StyleDefault
+
+// typing types a character at a random place, a newline now and then.
+func typing(e editors.Editor, rnd *rand.Rand) {
+	line := rnd.Intn(e.Length())
+	text, _ := e.GetLine(line)
+	r := rune('a' + rnd.Intn(26))
+	if rnd.Intn(30) == 0 {
+		r = '\n'
+	}
+	e.InsertChar(line, rnd.Intn(len(text)+1), r, style)
+}
+
+var block = strings.Repeat("\tfmt.Println(\"pasted\", i, err) // some pasted code\n", 20)
+
+// paste inserts a block of 20 lines at a random place.
+func paste(e editors.Editor, rnd *rand.Rand) {
+	e.InsertText(rnd.Intn(e.Length()+1), 0, block, style)
+}
+
+// deleteLine deletes a random line and, so the file keeps its size, inserts a
+// line at another random place.
+func deleteLine(e editors.Editor, rnd *rand.Rand) {
+	e.DeleteLine(rnd.Intn(e.Length()))
+	e.InsertLine(rnd.Intn(e.Length()+1), "\treturn nil", style)
+}
+
+// scroll reads a screen full of lines from a random place.
+func scroll(e editors.Editor, rnd *rand.Rand) {
+	top := rnd.Intn(e.Length())
+	for l := top; l < min(top+50, e.Length()); l++ {
+		e.GetLine(l)
+	}
+}
+
+// Lines returns about size bytes of Go like source, split into lines.
+func Lines(size int) []string {
+	var lines []string
+	total := 0
+	for i := 0; total < size; i++ {
+		var line string
+		switch i % 6 {
+		case 0:
+			line = fmt.Sprintf("func handler%d(w http.ResponseWriter, r *http.Request) error {", i)
+		case 1:
+			line = fmt.Sprintf("\tvalue%d, err := strconv.Atoi(r.URL.Query().Get(\"v%d\"))", i, i)
+		case 2:
+			line = "\tif err != nil {"
+		case 3:
+			line = "\t\treturn fmt.Errorf(\"bad value: %w\", err)"
+		case 4:
+			line = strings.Repeat("\t", 1) + "}"
+		case 5:
+			line = fmt.Sprintf("\treturn json.NewEncoder(w).Encode(value%d) // 世界 %d", i-4, i)
+		}
+		lines = append(lines, line)
+		total += len(line) + 1
+	}
+	return lines
+}
+
+// load puts lines into an empty editor the way goedit loads a file, and clears
+// the undo history that leaves behind.
+func load(newEditor func() editors.Editor, lines []string) editors.Editor {
+	e := newEditor()
+	for i, line := range lines {
+		e.InsertLine(i, line, style)
+	}
+	e.ClearHistory()
+	return e
+}
+
+// heapInUse returns the bytes of heap in use after a collection.
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// Benchmark returns the benchmark function for a trace run against a backend
+// at a size.  Besides time and allocations it reports, as "retained-B", the
+// heap the editor holds on to at the end, file and undo history included.
+func Benchmark(backend Backend, trace Trace, lines []string) func(b *testing.B) {
+	return func(b *testing.B) {
+		b.ReportAllocs()
+		before := heapInUse()
+		var e editors.Editor
+		if trace.Name == Load {
+			for i := 0; i < b.N; i++ {
+				e = nil
+				e = load(backend.New, lines)
+			}
+		} else {
+			e = load(backend.New, lines)
+			rnd := rand.New(rand.NewSource(1))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				trace.Op(e, rnd)
+			}
+		}
+		b.StopTimer()
+		b.ReportMetric(float64(heapInUse()-min(before, heapInUse())), "retained-B")
+		runtime.KeepAlive(e)
+	}
+}
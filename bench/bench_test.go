@@ -0,0 +1,41 @@
+package bench
+
+import (
+	"flag"
+	"math/rand"
+	"testing"
+)
+
+var large = flag.Bool("large", false, "also run the benchmarks on 100MB files")
+
+func BenchmarkTraces(b *testing.B) {
+	for _, size := range Sizes {
+		if size.Bytes > 1<<20 && !*large {
+			continue
+		}
+		lines := Lines(size.Bytes)
+		for _, trace := range Traces {
+			for _, backend := range Backends {
+				b.Run(trace.Name+"/"+size.Name+"/"+backend.Name, Benchmark(backend, trace, lines))
+			}
+		}
+	}
+}
+
+// TestTraces runs every trace a little, so they are known to work on every
+// backend without running the benchmarks.
+func TestTraces(t *testing.T) {
+	lines := Lines(Sizes[0].Bytes)
+	for _, backend := range Backends {
+		e := load(backend.New, lines)
+		if e.Length() != len(lines) {
+			t.Errorf("%s loaded %d lines, want %d", backend.Name, e.Length(), len(lines))
+		}
+		rnd := rand.New(rand.NewSource(1))
+		for _, trace := range Traces[1:] {
+			for i := 0; i < 100; i++ {
+				trace.Op(e, rnd)
+			}
+		}
+	}
+}
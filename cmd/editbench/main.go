@@ -0,0 +1,63 @@
+// editbench runs the editing traces of the bench package against every
+// editors.Editor backend and prints a table comparing them.
+//
+//	go run ./cmd/editbench -sizes 1KB,1MB,100MB
+//
+// The testing flags work as well, -test.benchtime=100x for example.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/Radisovik/goedit/bench"
+)
+
+func main() {
+	testing.Init()
+	sizes := flag.String("sizes", "1KB,1MB", "comma separated file sizes to run, out of 1KB, 1MB and 100MB")
+	traces := flag.String("traces", "", "comma separated traces to run, all of them when empty")
+	flag.Parse()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprint(w, "trace\tsize\t")
+	for _, backend := range bench.Backends {
+		fmt.Fprintf(w, "%s ns/op\tB/op\tallocs/op\tretained\t", backend.Name)
+	}
+	fmt.Fprintln(w)
+
+	for _, size := range bench.Sizes {
+		if !slices.Contains(strings.Split(*sizes, ","), size.Name) {
+			continue
+		}
+		lines := bench.Lines(size.Bytes)
+		for _, trace := range bench.Traces {
+			if *traces != "" && !slices.Contains(strings.Split(*traces, ","), trace.Name) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t", trace.Name, size.Name)
+			for _, backend := range bench.Backends {
+				r := testing.Benchmark(bench.Benchmark(backend, trace, lines))
+				fmt.Fprintf(w, "%d\t%d\t%d\t%s\t", r.NsPerOp(), r.AllocedBytesPerOp(), r.AllocsPerOp(), bytes(r.Extra["retained-B"]))
+			}
+			fmt.Fprintln(w)
+		}
+	}
+	w.Flush()
+}
+
+// bytes formats a byte count for people.
+func bytes(n float64) string {
+	for _, unit := range []string{"B", "KB", "MB"} {
+		if n < 1024 {
+			return fmt.Sprintf("%.0f%s", n, unit)
+		}
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1fGB", n)
+}
@@ -0,0 +1,104 @@
+package editors
+
+// Gravity decides where an anchor goes when text is inserted right at it.
+type Gravity int
+
+const (
+	// LeftGravity anchors stay in front of text inserted at them, like the
+	// start of a selection.
+	LeftGravity Gravity = iota
+	// RightGravity anchors move past text inserted at them, like a cursor.
+	RightGravity
+)
+
+type anchor struct {
+	id      int
+	pos     Position
+	gravity Gravity
+}
+
+// anchors are positions kept in place, relative to the text around them,
+// through every edit, undo and redo.  Every edit moves all of them, so they
+// are kept in a slice, the map only finds them by id.
+type anchors struct {
+	list   []*anchor
+	byID   map[int]int // index in list
+	nextID int
+}
+
+func (d *document) AddAnchor(pos Position, gravity Gravity) int {
+	d.checkPosition(pos.Line, pos.Column)
+	a := &d.anchors
+	if a.byID == nil {
+		a.byID = make(map[int]int)
+	}
+	a.nextID++
+	a.byID[a.nextID] = len(a.list)
+	a.list = append(a.list, &anchor{a.nextID, pos, gravity})
+	return a.nextID
+}
+
+func (d *document) AnchorPosition(id int) (Position, bool) {
+	i, ok := d.anchors.byID[id]
+	if !ok {
+		return Position{}, false
+	}
+	return d.anchors.list[i].pos, true
+}
+
+func (d *document) RemoveAnchor(id int) {
+	a := &d.anchors
+	i, ok := a.byID[id]
+	if !ok {
+		return
+	}
+	// the last one takes its place
+	last := a.list[len(a.list)-1]
+	a.list[i] = last
+	a.byID[last.id] = i
+	a.list = a.list[:len(a.list)-1]
+	delete(a.byID, id)
+}
+
+// moved updates the anchors after the text between start and end was replaced
+// by text ending at newEnd.  Anchors inside the replaced text end up at its
+// start or its end, depending on their gravity, and anchors at its end at the
+// end of the new text.  Where they were is returned so undo can put them back.
+func (a *anchors) moved(start, end, newEnd Position) map[int]Position {
+	var displaced map[int]Position
+	for _, an := range a.list {
+		p := an.pos
+		switch {
+		case p.Before(start):
+		case end.Before(p):
+			if p.Line == end.Line {
+				p = Position{newEnd.Line, newEnd.Column + p.Column - end.Column}
+			} else {
+				p.Line += newEnd.Line - end.Line
+			}
+		default:
+			if displaced == nil {
+				displaced = make(map[int]Position)
+			}
+			displaced[an.id] = p
+			// one right after the replaced text stays after it, whatever
+			// its gravity
+			if an.gravity == RightGravity || (p == end && start != end) {
+				p = newEnd
+			} else {
+				p = start
+			}
+		}
+		an.pos = p
+	}
+	return displaced
+}
+
+// restore puts anchors back where they were before an edit that is undone.
+func (a *anchors) restore(displaced map[int]Position) {
+	for id, p := range displaced {
+		if i, ok := a.byID[id]; ok {
+			a.list[i].pos = p
+		}
+	}
+}
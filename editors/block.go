@@ -0,0 +1,168 @@
+package editors
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Lines are shown with their tabs expanded, so what lines up on screen is a
+// matter of visual columns, screen cells from the start of the line, rather than
+// of runes.
+
+// VisualColumn returns the screen cell the rune at column of line is drawn at,
+// tabs reaching to the next multiple of tabWidth.
+func VisualColumn(line []rune, column int, tabWidth int) int {
+	visual := 0
+	for _, r := range line[:min(column, len(line))] {
+		visual = nextVisual(visual, r, tabWidth)
+	}
+	return visual + max(column-len(line), 0)
+}
+
+// RuneColumn is the inverse of VisualColumn, it returns the column of the rune
+// drawn over the screen cell visual, or the line's length when the line is too
+// short to reach it.
+func RuneColumn(line []rune, visual int, tabWidth int) int {
+	v := 0
+	for i, r := range line {
+		next := nextVisual(v, r, tabWidth)
+		if next > visual {
+			return i
+		}
+		v = next
+	}
+	return len(line)
+}
+
+func nextVisual(visual int, r rune, tabWidth int) int {
+	if r == '\t' {
+		return (visual/tabWidth + 1) * tabWidth
+	}
+	return visual + 1
+}
+
+// block is a rectangular selection, lines top to bottom and the visual columns
+// between left and right.
+type block struct {
+	anchor Position // where the block was started, the column is visual
+	head   Position // the corner opposite the anchor
+}
+
+func (b *block) bounds() (top, bottom, left, right int) {
+	return min(b.anchor.Line, b.head.Line), max(b.anchor.Line, b.head.Line),
+		min(b.anchor.Column, b.head.Column), max(b.anchor.Column, b.head.Column)
+}
+
+// SelectBlock selects the rectangle with corners from and to, their columns
+// being visual.  It is made of one selection per line, the parts of lines too
+// short to reach into the rectangle get an empty one at their end.
+func (c *Cursors) SelectBlock(from, to Position) {
+	to.Line = max(0, min(to.Line, c.e.Length()-1))
+	to.Column = max(to.Column, 0)
+	b := &block{anchor: from, head: to}
+	top, bottom, left, right := b.bounds()
+	var sels []Selection
+	for l := top; l <= bottom; l++ {
+		line, _ := c.e.GetLine(l)
+		start := Position{l, RuneColumn(line, left, c.tabWidth())}
+		end := Position{l, RuneColumn(line, right, c.tabWidth())}
+		if from.Column > to.Column {
+			start, end = end, start
+		}
+		sels = append(sels, Selection{Head: end, Tail: start})
+	}
+	// the cursor on the line the block grows to is the primary one
+	if to.Line < from.Line {
+		for i, j := 0, len(sels)-1; i < j; i, j = i+1, j-1 {
+			sels[i], sels[j] = sels[j], sels[i]
+		}
+	}
+	c.removeAll()
+	for _, sel := range sels {
+		c.add(sel)
+	}
+	c.merge()
+	c.block = b
+}
+
+// ExtendBlock grows the rectangular selection by lines and visual columns,
+// starting one at the primary cursor when there is none.
+func (c *Cursors) ExtendBlock(lines, columns int) {
+	if c.block == nil {
+		head := c.Primary().Head
+		line, _ := c.e.GetLine(head.Line)
+		start := Position{head.Line, VisualColumn(line, head.Column, c.tabWidth())}
+		c.block = &block{anchor: start, head: start}
+	}
+	c.SelectBlock(c.block.anchor, Position{c.block.head.Line + lines, c.block.head.Column + columns})
+}
+
+// InBlock reports whether the cursors are a rectangular selection.
+func (c *Cursors) InBlock() bool {
+	return c.block != nil
+}
+
+// padBlock fills the lines of a rectangular selection too short to reach into
+// it with spaces, so text typed into the block lines up.
+func (c *Cursors) padBlock(style tcell.Style) {
+	if c.block == nil {
+		return
+	}
+	_, _, left, _ := c.block.bounds()
+	for i, cur := range c.list {
+		sel := c.get(cur)
+		line, _ := c.e.GetLine(sel.Head.Line)
+		if short := left - VisualColumn(line, len(line), c.tabWidth()); short > 0 && sel.Empty() {
+			end := c.e.ReplaceRange(sel.Head, sel.Head, strings.Repeat(" ", short), style)
+			c.set(i, Selection{end, end})
+		}
+	}
+}
+
+// skip reports whether Backspace and Delete leave a cursor alone: in a
+// rectangular selection that is wider than nothing, the lines with nothing
+// selected, and in any of them, the lines too short to reach into it.
+func (c *Cursors) skip(start, end Position) bool {
+	if c.block == nil || start != end {
+		return false
+	}
+	_, _, left, right := c.block.bounds()
+	text, _ := c.e.GetLine(start.Line)
+	return left < right || VisualColumn(text, len(text), c.tabWidth()) < left
+}
+
+// PasteBlock pastes lines as a rectangle: one per line from the primary cursor
+// down, all at its visual column, padding short lines and adding lines at the
+// end of the text as needed.
+func (c *Cursors) PasteBlock(lines []string, style tcell.Style) {
+	if len(lines) == 0 {
+		return
+	}
+	head := c.Primary().Head
+	text, _ := c.e.GetLine(head.Line)
+	visual := VisualColumn(text, head.Column, c.tabWidth())
+	c.e.BeginTransaction(head)
+	c.removeAll()
+	for i, piece := range lines {
+		l := head.Line + i
+		if l >= c.e.Length() {
+			c.e.InsertLine(l, "", style)
+		}
+		text, _ := c.e.GetLine(l)
+		column := RuneColumn(text, visual, c.tabWidth())
+		pad := visual - VisualColumn(text, column, c.tabWidth())
+		pos := Position{l, column}
+		end := c.e.ReplaceRange(pos, pos, strings.Repeat(" ", max(pad, 0))+piece, style)
+		c.add(Selection{end, end})
+	}
+	c.merge()
+	c.e.EndTransaction(c.Primary().Head)
+}
+
+func (c *Cursors) tabWidth() int {
+	if c.TabWidth <= 0 {
+		return 8
+	}
+	return c.TabWidth
+}
@@ -0,0 +1,32 @@
+package editors_test
+
+import (
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/Radisovik/goedit/editors/editorstest"
+)
+
+func TestConformance(t *testing.T) {
+	for name, newEditor := range map[string]func() editors.Editor{
+		"DirtSimpleEditor": editors.NewDirtSimpleEditor,
+		"PieceTableEditor": editors.NewPieceTableEditor,
+		"RopeEditor":       editors.NewRopeEditor,
+	} {
+		t.Run(name, func(t *testing.T) {
+			editorstest.Run(t, newEditor)
+		})
+	}
+}
+
+func FuzzDirtSimpleEditor(f *testing.F) {
+	editorstest.Fuzz(f, editors.NewDirtSimpleEditor)
+}
+
+func FuzzPieceTableEditor(f *testing.F) {
+	editorstest.Fuzz(f, editors.NewPieceTableEditor)
+}
+
+func FuzzRopeEditor(f *testing.F) {
+	editorstest.Fuzz(f, editors.NewRopeEditor)
+}
@@ -0,0 +1,462 @@
+package editors
+
+import (
+	"slices"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Selection is the text between Tail, where selecting started, and Head, where
+// the cursor is.  Nothing is selected when they are the same.
+type Selection struct {
+	Head Position
+	Tail Position
+}
+
+func (s Selection) Empty() bool {
+	return s.Head == s.Tail
+}
+
+// Range returns the selection with its ends in order.
+func (s Selection) Range() (start, end Position) {
+	if s.Head.Before(s.Tail) {
+		return s.Head, s.Tail
+	}
+	return s.Tail, s.Head
+}
+
+// Cursors are the cursors editing an Editor, every one with a selection of its
+// own.  They are kept as anchors, so each one follows the edits made by the
+// others.  An edit made through Cursors is made at every cursor, as a single
+// undo step.
+type Cursors struct {
+	e     Editor
+	list  []cursor // in text order, once merged
+	added int      // cursors added so far
+	block *block   // set while the selections make up a rectangle
+
+	// TabWidth is the number of screen cells between tab stops, 8 when not set.
+	TabWidth int
+}
+
+type cursor struct {
+	head  int // anchor ids
+	tail  int
+	added int // when it was added, the cursor added last is the primary one
+}
+
+// NewCursors returns a single cursor at pos.
+func NewCursors(e Editor, pos Position) *Cursors {
+	c := &Cursors{e: e}
+	c.Reset(pos)
+	return c
+}
+
+// Reset drops every cursor and selection and puts a single cursor at pos.
+func (c *Cursors) Reset(pos Position) {
+	c.removeAll()
+	c.add(Selection{pos, pos})
+}
+
+// Set replaces every cursor with one per selection, the last one becomes the
+// primary cursor.
+func (c *Cursors) Set(selections []Selection) {
+	c.removeAll()
+	for _, sel := range selections {
+		c.add(sel)
+	}
+	c.merge()
+}
+
+// Collapse drops every cursor but the primary one, and its selection.
+func (c *Cursors) Collapse() {
+	c.Reset(c.Primary().Head)
+}
+
+// Primary returns the selection of the cursor added last.
+func (c *Cursors) Primary() Selection {
+	return c.get(c.list[c.primary()])
+}
+
+// Selections returns the selections of all the cursors, in text order.
+func (c *Cursors) Selections() []Selection {
+	rtn := make([]Selection, len(c.list))
+	for i, cur := range c.list {
+		rtn[i] = c.get(cur)
+	}
+	return rtn
+}
+
+// Move moves every cursor by lines and columns, moving past the start or end
+// of a line goes to the line before or after.  When extend is set the
+// selections grow, otherwise they are dropped.
+func (c *Cursors) Move(lines, columns int, extend bool) {
+	c.block = nil
+	for i, cur := range c.list {
+		sel := c.get(cur)
+		head := sel.Head
+		if lines != 0 {
+			head.Line = max(0, min(head.Line+lines, c.e.Length()-1))
+			head.Column = min(head.Column, c.lineLength(head.Line))
+		}
+		n := columns
+		for ; n < 0 && head != (Position{}); n++ {
+			if head.Column > 0 {
+				head.Column--
+			} else {
+				head = Position{head.Line - 1, c.lineLength(head.Line - 1)}
+			}
+		}
+		for ; n > 0 && head.Line < c.e.Length(); n-- {
+			if head.Column < c.lineLength(head.Line) {
+				head.Column++
+			} else if head.Line+1 < c.e.Length() {
+				head = Position{head.Line + 1, 0}
+			}
+		}
+		sel.Head = head
+		if !extend {
+			sel.Tail = head
+		}
+		c.set(i, sel)
+	}
+	c.merge()
+}
+
+// AddAbove adds a cursor on the line above the topmost cursor.
+func (c *Cursors) AddAbove() {
+	c.block = nil
+	top := c.Selections()[0].Head
+	if top.Line > 0 {
+		pos := Position{top.Line - 1, min(c.Primary().Head.Column, c.lineLength(top.Line-1))}
+		c.add(Selection{pos, pos})
+		c.merge()
+	}
+}
+
+// AddBelow adds a cursor on the line below the bottom cursor.
+func (c *Cursors) AddBelow() {
+	c.block = nil
+	all := c.Selections()
+	bottom := all[len(all)-1].Head
+	if bottom.Line+1 < c.e.Length() {
+		pos := Position{bottom.Line + 1, min(c.Primary().Head.Column, c.lineLength(bottom.Line+1))}
+		c.add(Selection{pos, pos})
+		c.merge()
+	}
+}
+
+// AddNextOccurrence selects the word under the primary cursor when nothing is
+// selected, and otherwise adds a cursor selecting the next occurrence of the
+// selected text.  It returns false when there is nothing (more) to select.
+func (c *Cursors) AddNextOccurrence() bool {
+	c.block = nil
+	primary := c.Primary()
+	if primary.Empty() {
+		start, end, ok := c.wordAt(primary.Head)
+		if ok {
+			c.set(c.primary(), Selection{Head: end, Tail: start})
+		}
+		return ok
+	}
+	start, end := primary.Range()
+	if start.Line != end.Line {
+		return false
+	}
+	needle := []rune(c.e.GetText(start, end))
+	taken := c.Selections()
+	from := end
+	for {
+		found, ok := find(c.e, needle, from)
+		if !ok || found == start {
+			return false
+		}
+		next := Selection{Head: Position{found.Line, found.Column + len(needle)}, Tail: found}
+		if !slices.ContainsFunc(taken, func(s Selection) bool { a, _ := s.Range(); return a == found }) {
+			c.add(next)
+			c.merge()
+			return true
+		}
+		from = next.Head
+	}
+}
+
+// SplitLines turns every selection spanning several lines into one selection
+// per line.
+func (c *Cursors) SplitLines() {
+	c.block = nil
+	var split []Selection
+	kept := c.list[:0]
+	for _, cur := range c.list {
+		start, end := c.get(cur).Range()
+		if start.Line == end.Line {
+			kept = append(kept, cur)
+			continue
+		}
+		for l := start.Line; l <= end.Line; l++ {
+			from, to := Position{l, 0}, Position{l, c.lineLength(l)}
+			if l == start.Line {
+				from = start
+			}
+			if l == end.Line {
+				if end.Column == 0 {
+					break
+				}
+				to = end
+			}
+			split = append(split, Selection{Head: to, Tail: from})
+		}
+		c.drop(cur)
+	}
+	c.list = kept
+	for _, sel := range split {
+		c.add(sel)
+	}
+	c.merge()
+}
+
+// Insert replaces every selection with text, or inserts it at every cursor.
+func (c *Cursors) Insert(text string, style tcell.Style) {
+	c.e.BeginTransaction(c.Primary().Head)
+	c.padBlock(style)
+	c.edit(func(i int, start, end Position) {
+		c.e.ReplaceRange(start, end, text, style)
+	})
+	c.e.EndTransaction(c.Primary().Head)
+}
+
+// InsertEach pastes texts, one per cursor in text order, when there are as
+// many of them as cursors, and all of them joined at every cursor otherwise.
+func (c *Cursors) InsertEach(texts []string, style tcell.Style) {
+	if len(texts) != len(c.list) {
+		joined := ""
+		for i, t := range texts {
+			if i > 0 {
+				joined += "\n"
+			}
+			joined += t
+		}
+		c.Insert(joined, style)
+		return
+	}
+	c.e.BeginTransaction(c.Primary().Head)
+	c.padBlock(style)
+	c.edit(func(i int, start, end Position) {
+		c.e.ReplaceRange(start, end, texts[i], style)
+	})
+	c.e.EndTransaction(c.Primary().Head)
+}
+
+// Backspace deletes the selections, or the character in front of every
+// cursor.
+func (c *Cursors) Backspace() {
+	c.edit(func(i int, start, end Position) {
+		if c.skip(start, end) {
+			return
+		}
+		if start == end && start != (Position{}) {
+			start = Position{start.Line, start.Column - 1}
+			if start.Column < 0 {
+				start = Position{start.Line - 1, c.lineLength(start.Line - 1)}
+			}
+		}
+		c.e.DeleteRange(start, end)
+	})
+}
+
+// Delete deletes the selections, or the character after every cursor.
+func (c *Cursors) Delete() {
+	c.edit(func(i int, start, end Position) {
+		if c.skip(start, end) {
+			return
+		}
+		if start == end && start.Line < c.e.Length() {
+			if start.Column < c.lineLength(start.Line) {
+				end = Position{start.Line, start.Column + 1}
+			} else if start.Line+1 < c.e.Length() {
+				end = Position{start.Line + 1, 0}
+			}
+		}
+		c.e.DeleteRange(start, end)
+	})
+}
+
+// Texts returns the selected text of every cursor, in text order.
+func (c *Cursors) Texts() []string {
+	var rtn []string
+	for _, sel := range c.Selections() {
+		rtn = append(rtn, c.e.GetText(sel.Range()))
+	}
+	return rtn
+}
+
+// Cut returns the selected texts and deletes them.
+func (c *Cursors) Cut() []string {
+	texts := c.Texts()
+	c.edit(func(i int, start, end Position) {
+		c.e.DeleteRange(start, end)
+	})
+	return texts
+}
+
+// edit calls fn with the selection of every cursor, in text order, inside one
+// transaction and then drops the selections, and the rectangle they made up.
+func (c *Cursors) edit(fn func(i int, start, end Position)) {
+	c.e.BeginTransaction(c.Primary().Head)
+	for i, cur := range c.list {
+		start, end := c.get(cur).Range()
+		fn(i, start, end)
+	}
+	for i, cur := range c.list {
+		head := c.get(cur).Head
+		c.set(i, Selection{head, head})
+	}
+	c.block = nil
+	c.merge()
+	c.e.EndTransaction(c.Primary().Head)
+}
+
+// add adds a cursor, which becomes the primary one.  The cursors are out of
+// text order until they are merged.
+func (c *Cursors) add(sel Selection) {
+	c.added++
+	c.list = append(c.list, cursor{
+		head:  c.e.AddAnchor(sel.Head, RightGravity),
+		tail:  c.e.AddAnchor(sel.Tail, LeftGravity),
+		added: c.added,
+	})
+}
+
+// primary returns the index of the cursor added last.
+func (c *Cursors) primary() int {
+	p := 0
+	for i, cur := range c.list {
+		if cur.added > c.list[p].added {
+			p = i
+		}
+	}
+	return p
+}
+
+func (c *Cursors) removeAll() {
+	for _, cur := range c.list {
+		c.e.RemoveAnchor(cur.head)
+		c.e.RemoveAnchor(cur.tail)
+	}
+	c.list = nil
+	c.block = nil
+}
+
+// drop removes the anchors of a cursor taken out of the list.
+func (c *Cursors) drop(cur cursor) {
+	c.e.RemoveAnchor(cur.head)
+	c.e.RemoveAnchor(cur.tail)
+}
+
+func (c *Cursors) get(cur cursor) Selection {
+	head, _ := c.e.AnchorPosition(cur.head)
+	tail, _ := c.e.AnchorPosition(cur.tail)
+	return Selection{head, tail}
+}
+
+// set moves the i-th cursor to sel.
+func (c *Cursors) set(i int, sel Selection) {
+	cur := c.list[i]
+	c.drop(cur)
+	c.list[i] = cursor{
+		head:  c.e.AddAnchor(sel.Head, RightGravity),
+		tail:  c.e.AddAnchor(sel.Tail, LeftGravity),
+		added: cur.added,
+	}
+}
+
+// merge puts the cursors in text order and drops those whose selections
+// overlap the selection of a cursor added later.
+func (c *Cursors) merge() {
+	type ranged struct {
+		cur        cursor
+		start, end Position
+	}
+	sorted := make([]ranged, len(c.list))
+	for i, cur := range c.list {
+		start, end := c.get(cur).Range()
+		sorted[i] = ranged{cur, start, end}
+	}
+	slices.SortStableFunc(sorted, func(a, b ranged) int { return compare(a.start, b.start) })
+	// a selection can only overlap the one kept before it
+	c.list = c.list[:0]
+	var last ranged
+	for _, r := range sorted {
+		if len(c.list) > 0 && (r.start == last.start || r.start.Before(last.end)) {
+			if r.cur.added < last.cur.added {
+				c.drop(r.cur)
+				continue
+			}
+			c.drop(last.cur)
+			c.list = c.list[:len(c.list)-1]
+		}
+		c.list = append(c.list, r.cur)
+		last = r
+	}
+}
+
+func (c *Cursors) lineLength(line int) int {
+	runes, _ := c.e.GetLine(line)
+	return len(runes)
+}
+
+// wordAt returns the word around pos.
+func (c *Cursors) wordAt(pos Position) (Position, Position, bool) {
+	if pos.Line >= c.e.Length() {
+		return pos, pos, false
+	}
+	line, _ := c.e.GetLine(pos.Line)
+	start, end := pos.Column, pos.Column
+	for start > 0 && isWordRune(line[start-1]) {
+		start--
+	}
+	for end < len(line) && isWordRune(line[end]) {
+		end++
+	}
+	return Position{pos.Line, start}, Position{pos.Line, end}, start < end
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// find returns where needle, which holds no newline, next occurs at or after
+// from, going around to the start of the text after the end.
+func find(e Editor, needle []rune, from Position) (Position, bool) {
+	n := e.Length()
+	for i := 0; i <= n; i++ {
+		l := (from.Line + i) % max(n, 1)
+		line, _ := e.GetLine(l)
+		start := 0
+		if i == 0 {
+			start = min(from.Column, len(line))
+		}
+		limit := len(line)
+		if i == n {
+			// back on the first line, up to where the search started
+			limit = min(from.Column+len(needle)-1, len(line))
+		}
+		for col := start; col+len(needle) <= limit; col++ {
+			if slices.Equal(line[col:col+len(needle)], needle) {
+				return Position{l, col}, true
+			}
+		}
+	}
+	return Position{}, false
+}
+
+func compare(a, b Position) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case b.Before(a):
+		return 1
+	}
+	return 0
+}
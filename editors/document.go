@@ -0,0 +1,380 @@
+package editors
+
+import (
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// storage is what an Editor implementation has to provide.  Everything in the
+// Editor interface beyond reading lines is built on top of it by document, so
+// all implementations behave the same way and share undo.
+//
+// Every line is considered terminated by a newline, so an empty document and
+// a document holding one empty line are different things.
+type storage interface {
+	Length() int
+	GetLine(line int) ([]rune, []tcell.Style)
+
+	// replace swaps the text between start and end for segs (the new text split
+	// at its newlines) and returns the removed and inserted text, the latter
+	// with an extra empty segment when the last line had to be terminated.
+	replace(start, end Position, segs []StyledLine) (removed, inserted []StyledLine)
+
+	// restyle changes the style of length characters of a line.
+	restyle(line int, column int, length int, style tcell.Style)
+}
+
+// snapshotter is implemented by storage that can hand out its whole text
+// cheaply, undo and redo then take the text of an edit from the snapshots taken
+// around it instead of replaying the edit.
+type snapshotter interface {
+	snapshot() any
+
+	// restore replaces the text between start and end with the text between
+	// start and snapEnd in the snapshot, the rest is left alone.
+	restore(snapshot any, start, end, snapEnd Position)
+}
+
+// document implements the editing operations of the Editor interface on top
+// of a storage, implementations embed it.
+type document struct {
+	store       storage
+	history     history
+	anchors     anchors
+	subscribers subscribers
+}
+
+func newDocument(store storage) document {
+	d := document{store: store}
+	if s, ok := store.(snapshotter); ok {
+		d.history.snapshot = s.snapshot
+	}
+	return d
+}
+
+// InsertLine inserts a line of text in front of line, shifting it and the lines
+// below it down.  If styles are provided they are applied to the characters of
+// the text.
+func (d *document) InsertLine(line int, text string, style ...tcell.Style) {
+	if line < 0 || line > d.store.Length() {
+		panic("line index out of range")
+	}
+	d.edit(Position{line, 0}, Position{line, 0}, []StyledLine{makeStyledLine(style, text), nil})
+}
+
+// InsertChar inserts a character at a specified position in the text editor.
+// If the character is '\n', it splits the current line into two, with the part
+// before the cursor remaining on the current line and the part after the cursor
+// moved to a new line below.
+func (d *document) InsertChar(line int, column int, text rune, style tcell.Style) {
+	d.checkPosition(line, column)
+	if text == '\n' {
+		d.edit(Position{line, column}, Position{line, column}, []StyledLine{nil, nil})
+	} else {
+		d.edit(Position{line, column}, Position{line, column}, []StyledLine{{{text, style}}})
+	}
+}
+
+// DeleteLine remove the line of text, along with the styles, shifting lines and styles up
+func (d *document) DeleteLine(line int) {
+	if line < 0 {
+		panic("line index out of range")
+	}
+	if d.store.Length() == 0 {
+		return
+	}
+	if line >= d.store.Length() {
+		panic("line index out of range")
+	}
+	d.edit(Position{line, 0}, Position{line + 1, 0}, []StyledLine{nil})
+}
+
+// DeleteChar removes the character at the given position, deleting past the
+// end of a line joins it with the next one.
+func (d *document) DeleteChar(line int, column int) {
+	if line < 0 || line >= d.store.Length() {
+		panic("line index out of range")
+	}
+	length := d.lineLength(line)
+	end := Position{line, column + 1}
+	if column == length && line+1 < d.store.Length() {
+		end = Position{line + 1, 0}
+	} else if column < 0 || column >= length {
+		panic("column index out of range")
+	}
+	d.edit(Position{line, column}, end, []StyledLine{nil})
+}
+
+// InsertText inserts msg, which may span several lines, at column pos of line.
+func (d *document) InsertText(line int, pos int, msg string, style tcell.Style) {
+	d.ReplaceRange(Position{line, pos}, Position{line, pos}, msg, style)
+}
+
+// GetText returns the text between start and end, lines separated by '\n'.
+// A range running to the end of the document takes the newline ending the
+// last line too.
+func (d *document) GetText(start, end Position) string {
+	d.checkRange(start, end)
+	var text []rune
+	for l := start.Line; l <= min(end.Line, d.store.Length()-1); l++ {
+		runes, _ := d.store.GetLine(l)
+		from, to := 0, len(runes)
+		if l == start.Line {
+			from = start.Column
+		}
+		if l == end.Line {
+			to = end.Column
+		}
+		text = append(text, runes[from:to]...)
+		if l < end.Line {
+			text = append(text, '\n')
+		}
+	}
+	return string(text)
+}
+
+// DeleteRange removes the text between start and end.
+func (d *document) DeleteRange(start, end Position) {
+	d.checkRange(start, end)
+	if start != end {
+		d.edit(start, end, []StyledLine{nil})
+	}
+}
+
+// ReplaceRange replaces the text between start and end with text, which may
+// span several lines, and returns where the new text ends.
+func (d *document) ReplaceRange(start, end Position, text string, style tcell.Style) Position {
+	d.checkRange(start, end)
+	segs := make([]StyledLine, 0, 1)
+	for _, seg := range splitRunes([]rune(text)) {
+		segs = append(segs, makeStyledLine([]tcell.Style{style}, string(seg)))
+	}
+	d.edit(start, end, segs)
+	return endOf(start, segs)
+}
+
+// SetLine replaces the content of the line, or adds it when it doesn't exist.
+func (d *document) SetLine(line int, text string, style ...tcell.Style) {
+	if line < 0 {
+		panic("line index out of range")
+	} else if line >= d.store.Length() {
+		d.InsertLine(line, text, style...)
+		return
+	}
+	d.edit(Position{line, 0}, Position{line, d.lineLength(line)}, []StyledLine{makeStyledLine(style, text)})
+}
+
+// ApplyStyle changes the style of length characters from column on, styling
+// is not an edit and can't be undone.
+func (d *document) ApplyStyle(line int, column int, length int, style tcell.Style) {
+	if line < 0 || line >= d.store.Length() {
+		return
+	}
+	d.store.restyle(line, column, length, style)
+}
+
+func (d *document) BeginTransaction(cursor Position) {
+	d.history.begin(cursor)
+}
+
+func (d *document) EndTransaction(cursor Position) {
+	d.history.end(cursor)
+}
+
+func (d *document) Undo() (Position, bool) {
+	d.history.commit()
+	d.history.init()
+	s := d.history.current
+	if s.parent == nil {
+		return Position{}, false
+	}
+	d.stepOut(s)
+	return s.before, true
+}
+
+func (d *document) Redo() (Position, bool) {
+	d.history.commit()
+	d.history.init()
+	s := d.history.current.redo
+	if s == nil {
+		return Position{}, false
+	}
+	d.stepIn(s)
+	return s.after, true
+}
+
+func (d *document) History() []HistoryState {
+	d.history.commit()
+	return d.history.describe()
+}
+
+func (d *document) GotoState(id int) (Position, bool) {
+	d.history.commit()
+	d.history.init()
+	if id < 0 || id >= len(d.history.states) {
+		return Position{}, false
+	}
+	up, down := d.history.path(d.history.states[id])
+	if len(up) == 0 && len(down) == 0 {
+		return Position{}, false
+	}
+	for _, s := range up {
+		d.stepOut(s)
+	}
+	for _, s := range down {
+		d.stepIn(s)
+	}
+	if len(down) > 0 {
+		return down[len(down)-1].after, true
+	}
+	return up[len(up)-1].before, true
+}
+
+func (d *document) Earlier(duration time.Duration) (Position, bool) {
+	d.history.commit()
+	d.history.init()
+	return d.GotoState(d.history.at(d.history.current.time.Add(-duration)).id)
+}
+
+func (d *document) Later(duration time.Duration) (Position, bool) {
+	d.history.commit()
+	d.history.init()
+	return d.GotoState(d.history.at(d.history.current.time.Add(duration)).id)
+}
+
+// MarkSaved records that the text as it is now has been saved.
+func (d *document) MarkSaved() {
+	d.history.commit()
+	d.history.init()
+	d.history.saved = d.history.current
+}
+
+// Modified reports whether the text changed since MarkSaved was called, or
+// the undo tree was cleared or read.  Undoing or redoing back to where it was
+// makes the text unmodified again.
+func (d *document) Modified() bool {
+	if d.history.open != nil && len(d.history.open.edits) > 0 {
+		return true
+	}
+	return d.history.current != d.history.saved
+}
+
+// stepOut reverts the edits of the current state, making its parent current.
+// Storage keeping snapshots takes the text of each edit back from the one
+// from before it instead of replaying it backwards.
+func (d *document) stepOut(s *state) {
+	for i := len(s.edits) - 1; i >= 0; i-- {
+		e := s.edits[i]
+		if e.before != nil {
+			d.store.(snapshotter).restore(e.before, e.start, endOf(e.start, e.inserted), endOf(e.start, e.removed))
+		} else {
+			d.store.replace(e.start, endOf(e.start, e.inserted), e.removed)
+		}
+		d.changed(e.start, endOf(e.start, e.inserted), e.inserted, e.removed)
+		d.anchors.restore(e.displaced)
+	}
+	d.history.current = s.parent
+	s.parent.redo = s
+}
+
+// stepIn applies the edits of a child of the current state, making it current.
+func (d *document) stepIn(s *state) {
+	for _, e := range s.edits {
+		if e.after != nil {
+			d.store.(snapshotter).restore(e.after, e.start, endOf(e.start, e.removed), endOf(e.start, e.inserted))
+		} else {
+			d.store.replace(e.start, endOf(e.start, e.removed), e.inserted)
+		}
+		d.changed(e.start, endOf(e.start, e.removed), e.removed, e.inserted)
+	}
+	d.history.current = s
+	s.parent.redo = s
+}
+
+// edit replaces the text between start and end and records it for undo.
+func (d *document) edit(start, end Position, segs []StyledLine) {
+	// the root state has to be taken before the first edit
+	d.history.init()
+	var e edit
+	if d.history.snapshot != nil {
+		e.before = d.history.snapshot()
+	}
+	e.start = start
+	e.removed, e.inserted = d.store.replace(start, end, segs)
+	if d.history.snapshot != nil {
+		e.after = d.history.snapshot()
+	}
+	e.displaced = d.changed(start, end, e.removed, e.inserted)
+	d.history.record(e)
+}
+
+func (d *document) lineLength(line int) int {
+	runes, _ := d.store.GetLine(line)
+	return len(runes)
+}
+
+func (d *document) checkRange(start, end Position) {
+	d.checkPosition(start.Line, start.Column)
+	d.checkPosition(end.Line, end.Column)
+	if end.Line < start.Line || (end.Line == start.Line && end.Column < start.Column) {
+		panic("range ends before it starts")
+	}
+}
+
+func (d *document) checkPosition(line int, column int) {
+	length := d.store.Length()
+	if line < 0 || line > length || (line == length && column != 0) {
+		panic("line index out of range")
+	}
+	if line < length && (column < 0 || column > d.lineLength(line)) {
+		panic("column index out of range")
+	}
+}
+
+// makeStyledLine pairs the runes of text with their styles: one style per rune,
+// a single style for all of them, or the default style.
+func makeStyledLine(style []tcell.Style, text string) StyledLine {
+	var styledLine StyledLine
+	idx := 0
+	for _, char := range text {
+		s := tcell.StyleDefault
+		if len(style) > 1 {
+			s = style[idx]
+		} else if len(style) == 1 {
+			s = style[0]
+		}
+		styledLine = append(styledLine, StyledChar{Char: char, Style: s})
+		idx++
+	}
+	return styledLine
+}
+
+// splitStyled splits a StyledLine into its runes and styles.
+func splitStyled(line StyledLine) ([]rune, []tcell.Style) {
+	if line == nil {
+		return nil, nil
+	}
+	runes := make([]rune, len(line))
+	styles := make([]tcell.Style, len(line))
+	for i, c := range line {
+		runes[i] = c.Char
+		styles[i] = c.Style
+	}
+	return runes, styles
+}
+
+// joinStyled is the inverse of splitStyled.
+func joinStyled(runes []rune, styles []tcell.Style) StyledLine {
+	if len(runes) == 0 {
+		return nil
+	}
+	line := make(StyledLine, len(runes))
+	for i, r := range runes {
+		line[i] = StyledChar{Char: r, Style: tcell.StyleDefault}
+		if i < len(styles) {
+			line[i].Style = styles[i]
+		}
+	}
+	return line
+}
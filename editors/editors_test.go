@@ -1,8 +1,15 @@
 package editors
 
 import (
+	"bytes"
+	"fmt"
+	"github.com/gdamore/tcell/v2"
 	"github.com/stretchr/testify/assert"
+	"math/rand"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestDirtSimple(t *testing.T) {
@@ -26,3 +33,821 @@ func TestDirtSimple(t *testing.T) {
 func toString(chars []rune) string {
 	return string(chars)
 }
+
+func TestPieceTableEditor(t *testing.T) {
+	pt := NewPieceTableEditor()
+
+	pt.InsertLine(0, "foo")
+	pt.InsertLine(1, "bar")
+	pt.InsertLine(0, "baz")
+	assert.Equal(t, 3, pt.Length())
+	assert.Equal(t, []string{"baz", "foo", "bar"}, allLines(pt))
+
+	pt.InsertChar(1, 3, '!', tcell.StyleDefault)
+	pt.InsertChar(1, 1, '\n', tcell.StyleDefault)
+	assert.Equal(t, []string{"baz", "f", "oo!", "bar"}, allLines(pt))
+
+	pt.DeleteChar(1, 1)
+	assert.Equal(t, []string{"baz", "foo!", "bar"}, allLines(pt))
+
+	pt.DeleteLine(2)
+	assert.Equal(t, []string{"baz", "foo!"}, allLines(pt))
+
+	pt.Undo()
+	assert.Equal(t, []string{"baz", "foo!", "bar"}, allLines(pt))
+	pt.Undo()
+	assert.Equal(t, []string{"baz", "f", "oo!", "bar"}, allLines(pt))
+	pt.Redo()
+	assert.Equal(t, []string{"baz", "foo!", "bar"}, allLines(pt))
+
+	pt.DeleteLine(0)
+	pt.DeleteLine(0)
+	pt.DeleteLine(0)
+	assert.Equal(t, 0, pt.Length())
+}
+
+func TestPieceTableEditorStyles(t *testing.T) {
+	red := tcell.StyleDefault.Foreground(tcell.ColorRed)
+	blue := tcell.StyleDefault.Foreground(tcell.ColorBlue)
+	pt := NewPieceTableEditor()
+
+	pt.InsertLine(0, "héllo", red)
+	pt.InsertChar(0, 2, 'x', blue)
+	line, styles := pt.GetLine(0)
+	assert.Equal(t, "héxllo", toString(line))
+	assert.Equal(t, []tcell.Style{red, red, blue, red, red, red}, styles)
+
+	pt.ApplyStyle(0, 0, 2, blue)
+	_, styles = pt.GetLine(0)
+	assert.Equal(t, []tcell.Style{blue, blue, blue, red, red, red}, styles)
+
+	pt.InsertText(0, 2, "in\nserted", red)
+	line, _ = pt.GetLine(0)
+	assert.Equal(t, "héin", toString(line))
+	line, _ = pt.GetLine(1)
+	assert.Equal(t, "sertedxllo", toString(line))
+	assert.Equal(t, 2, pt.Length())
+}
+
+func TestRanges(t *testing.T) {
+	red := tcell.StyleDefault.Foreground(tcell.ColorRed)
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertText(0, 0, "one\ntwo\nthree\n", red)
+			assert.Equal(t, []string{"one", "two", "three"}, allLines(e))
+			assert.Equal(t, "ne\ntw", e.GetText(Position{0, 1}, Position{1, 2}))
+			assert.Equal(t, "one\ntwo\nthree\n", e.GetText(Position{0, 0}, Position{3, 0}))
+			assert.Equal(t, "", e.GetText(Position{1, 1}, Position{1, 1}))
+
+			e.DeleteRange(Position{0, 2}, Position{2, 1})
+			assert.Equal(t, []string{"onhree"}, allLines(e))
+
+			end := e.ReplaceRange(Position{0, 1}, Position{0, 3}, "A\nB\nC", tcell.StyleDefault)
+			assert.Equal(t, Position{2, 1}, end)
+			assert.Equal(t, []string{"oA", "B", "Cree"}, allLines(e))
+			_, styles := e.GetLine(2)
+			assert.Equal(t, []tcell.Style{tcell.StyleDefault, red, red, red}, styles)
+
+			// text put at the end without a newline gets one
+			e.ReplaceRange(Position{3, 0}, Position{3, 0}, "tail", red)
+			assert.Equal(t, []string{"oA", "B", "Cree", "tail"}, allLines(e))
+
+			e.Undo()
+			e.Undo()
+			assert.Equal(t, []string{"onhree"}, allLines(e))
+
+			assert.Panics(t, func() { e.GetText(Position{0, 3}, Position{0, 1}) })
+			assert.Panics(t, func() { e.DeleteRange(Position{0, 0}, Position{0, 99}) })
+		})
+	}
+}
+
+func allLines(e Editor) []string {
+	var lines []string
+	for i := 0; i < e.Length(); i++ {
+		line, _ := e.GetLine(i)
+		lines = append(lines, toString(line))
+	}
+	return lines
+}
+
+var implementations = map[string]func() Editor{
+	"DirtSimpleEditor": NewDirtSimpleEditor,
+	"PieceTableEditor": NewPieceTableEditor,
+	"RopeEditor":       NewRopeEditor,
+}
+
+func TestTransactions(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertLine(0, "func main() {")
+			e.InsertLine(1, "}")
+
+			// a typed word is one step
+			e.BeginTransaction(Position{0, 13})
+			e.InsertChar(0, 13, '\n', tcell.StyleDefault)
+			for i, r := range "\tfoo" {
+				e.InsertChar(1, i, r, tcell.StyleDefault)
+			}
+			e.EndTransaction(Position{1, 4})
+			assert.Equal(t, []string{"func main() {", "\tfoo", "}"}, allLines(e))
+
+			// transactions nest
+			e.BeginTransaction(Position{1, 4})
+			e.BeginTransaction(Position{1, 4})
+			e.InsertChar(1, 4, '(', tcell.StyleDefault)
+			e.EndTransaction(Position{1, 5})
+			e.InsertChar(1, 5, ')', tcell.StyleDefault)
+			e.EndTransaction(Position{1, 6})
+			assert.Equal(t, []string{"func main() {", "\tfoo()", "}"}, allLines(e))
+
+			cursor, ok := e.Undo()
+			assert.True(t, ok)
+			assert.Equal(t, Position{1, 4}, cursor)
+			assert.Equal(t, []string{"func main() {", "\tfoo", "}"}, allLines(e))
+
+			cursor, ok = e.Undo()
+			assert.True(t, ok)
+			assert.Equal(t, Position{0, 13}, cursor)
+			assert.Equal(t, []string{"func main() {", "}"}, allLines(e))
+
+			cursor, ok = e.Redo()
+			assert.True(t, ok)
+			assert.Equal(t, Position{1, 4}, cursor)
+			assert.Equal(t, []string{"func main() {", "\tfoo", "}"}, allLines(e))
+
+			// edits outside a transaction are steps of their own
+			e.DeleteLine(1)
+			cursor, _ = e.Undo()
+			assert.Equal(t, Position{1, 0}, cursor)
+			assert.Equal(t, []string{"func main() {", "\tfoo", "}"}, allLines(e))
+
+			e.Undo()
+			e.Undo()
+			e.Undo()
+			_, ok = e.Undo()
+			assert.False(t, ok)
+			assert.Equal(t, 0, e.Length())
+		})
+	}
+}
+
+func TestUndoKeepsStyles(t *testing.T) {
+	red := tcell.StyleDefault.Foreground(tcell.ColorRed)
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertLine(0, "abc", red)
+			e.DeleteChar(0, 1)
+			e.Undo()
+			line, styles := e.GetLine(0)
+			assert.Equal(t, "abc", toString(line))
+			assert.Equal(t, []tcell.Style{red, red, red}, styles)
+		})
+	}
+}
+
+func TestUndoTree(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			clock := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+			documentOf(e).history.now = func() time.Time { return clock }
+
+			e.InsertLine(0, "one") // state 1
+			clock = clock.Add(time.Minute)
+			e.InsertLine(1, "two") // state 2
+			clock = clock.Add(time.Minute)
+			e.Undo()
+			e.InsertLine(1, "three") // state 3, a new branch next to 2
+			clock = clock.Add(time.Minute)
+			assert.Equal(t, []string{"one", "three"}, allLines(e))
+
+			states := e.History()
+			assert.Len(t, states, 4)
+			assert.Equal(t, []int{2, 3}, states[1].Children)
+			assert.True(t, states[3].Current)
+			assert.Equal(t, "+three⏎", states[3].Summary)
+
+			// the abandoned branch is still there
+			cursor, ok := e.GotoState(2)
+			assert.True(t, ok)
+			assert.Equal(t, Position{2, 0}, cursor)
+			assert.Equal(t, []string{"one", "two"}, allLines(e))
+			e.GotoState(3)
+			assert.Equal(t, []string{"one", "three"}, allLines(e))
+			e.GotoState(0)
+			assert.Equal(t, 0, e.Length())
+
+			// Redo follows the branch visited last
+			e.Redo()
+			e.Redo()
+			assert.Equal(t, []string{"one", "three"}, allLines(e))
+
+			// travel in time, state 3 was made at 12:02
+			_, ok = e.Earlier(90 * time.Second)
+			assert.True(t, ok)
+			assert.Equal(t, []string{"one"}, allLines(e))
+			e.Later(time.Minute)
+			assert.Equal(t, []string{"one", "two"}, allLines(e))
+			e.Earlier(time.Hour)
+			assert.Equal(t, 0, e.Length())
+			_, ok = e.Earlier(time.Hour)
+			assert.False(t, ok)
+		})
+	}
+}
+
+func TestModified(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			assert.False(t, e.Modified())
+			e.InsertText(0, 0, "foo\n", tcell.StyleDefault)
+			assert.True(t, e.Modified())
+			e.Undo()
+			assert.False(t, e.Modified())
+			e.Redo()
+			e.MarkSaved()
+			assert.False(t, e.Modified())
+
+			// an open transaction counts as soon as it edits
+			e.BeginTransaction(Position{})
+			assert.False(t, e.Modified())
+			e.InsertChar(0, 0, 'x', tcell.StyleDefault)
+			assert.True(t, e.Modified())
+			e.EndTransaction(Position{})
+			e.Undo()
+			assert.False(t, e.Modified())
+
+			// a branch away from the saved state and back
+			e.InsertChar(0, 0, 'y', tcell.StyleDefault)
+			e.Undo()
+			e.Undo()
+			assert.True(t, e.Modified())
+			e.Redo()
+			assert.False(t, e.Modified())
+
+			e.ClearHistory()
+			assert.False(t, e.Modified())
+		})
+	}
+}
+
+func TestHistoryRoundTrip(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertLine(0, "one")
+			e.InsertLine(1, "two")
+			e.Undo()
+			e.InsertLine(1, "three")
+			e.InsertChar(0, 3, '!', tcell.StyleDefault)
+			e.MarkSaved()
+
+			var buf bytes.Buffer
+			assert.NoError(t, e.WriteHistory(&buf))
+
+			// a fresh editor holding the same text, as after a restart
+			loaded := newEditor()
+			loaded.InsertLine(0, "one!")
+			loaded.InsertLine(1, "three")
+			loaded.ClearHistory()
+			assert.NoError(t, loaded.ReadHistory(&buf))
+			want, got := e.History(), loaded.History()
+			assert.Len(t, got, len(want))
+			for i := range want {
+				assert.True(t, want[i].Time.Equal(got[i].Time))
+				want[i].Time, got[i].Time = time.Time{}, time.Time{}
+			}
+			assert.Equal(t, want, got)
+
+			loaded.Undo()
+			assert.Equal(t, []string{"one", "three"}, allLines(loaded))
+			loaded.GotoState(2)
+			assert.Equal(t, []string{"one", "two"}, allLines(loaded))
+			loaded.GotoState(0)
+			assert.Equal(t, 0, loaded.Length())
+
+			assert.Error(t, loaded.ReadHistory(strings.NewReader(`{"Current":3,"States":[{"Parent":-1}]}`)))
+
+			// edits that weren't saved are written as something to redo
+			e.InsertLine(2, "unsaved")
+			buf.Reset()
+			assert.NoError(t, e.WriteHistory(&buf))
+			loaded = newEditor()
+			loaded.InsertLine(0, "one!")
+			loaded.InsertLine(1, "three")
+			loaded.ClearHistory()
+			assert.NoError(t, loaded.ReadHistory(&buf))
+			assert.False(t, loaded.Modified())
+			_, ok := loaded.Redo()
+			assert.True(t, ok)
+			assert.Equal(t, []string{"one!", "three", "unsaved"}, allLines(loaded))
+		})
+	}
+}
+
+func TestAnchors(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertText(0, 0, "one two\nthree\n", tcell.StyleDefault)
+			left := e.AddAnchor(Position{0, 4}, LeftGravity)
+			right := e.AddAnchor(Position{0, 4}, RightGravity)
+			below := e.AddAnchor(Position{1, 2}, LeftGravity)
+			end := e.AddAnchor(Position{2, 0}, RightGravity)
+			at := func(id int) Position {
+				pos, ok := e.AnchorPosition(id)
+				assert.True(t, ok)
+				return pos
+			}
+
+			// text inserted at the anchors
+			e.InsertText(0, 4, "big\n", tcell.StyleDefault)
+			assert.Equal(t, Position{0, 4}, at(left))
+			assert.Equal(t, Position{1, 0}, at(right))
+			assert.Equal(t, Position{2, 2}, at(below))
+			assert.Equal(t, Position{3, 0}, at(end))
+
+			// text inserted in front of them on the same line
+			e.InsertChar(1, 0, '>', tcell.StyleDefault)
+			assert.Equal(t, Position{1, 1}, at(right))
+			assert.Equal(t, Position{2, 2}, at(below))
+
+			// deleting text around an anchor collapses it
+			e.DeleteRange(Position{0, 2}, Position{2, 1})
+			assert.Equal(t, Position{0, 2}, at(left))
+			assert.Equal(t, Position{0, 2}, at(right))
+			assert.Equal(t, Position{0, 3}, at(below))
+			assert.Equal(t, []string{"onhree"}, allLines(e))
+
+			// and undo puts them back
+			e.Undo()
+			e.Undo()
+			assert.Equal(t, Position{1, 0}, at(right))
+			assert.Equal(t, Position{2, 2}, at(below))
+			e.Undo()
+			assert.Equal(t, Position{0, 4}, at(left))
+			assert.Equal(t, Position{0, 4}, at(right))
+			assert.Equal(t, Position{1, 2}, at(below))
+			assert.Equal(t, Position{2, 0}, at(end))
+			e.Redo()
+			assert.Equal(t, Position{2, 2}, at(below))
+
+			e.RemoveAnchor(below)
+			_, ok := e.AnchorPosition(below)
+			assert.False(t, ok)
+
+			// an anchor right after replaced text stays after the new text
+			after := e.AddAnchor(Position{0, 3}, LeftGravity)
+			e.ReplaceRange(Position{0, 0}, Position{0, 3}, "quux", tcell.StyleDefault)
+			assert.Equal(t, Position{0, 4}, at(after))
+			e.Undo()
+			assert.Equal(t, Position{0, 3}, at(after))
+		})
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			var events []ChangeEvent
+			id := e.Subscribe(func(ev ChangeEvent) { events = append(events, ev) })
+			e.InsertText(0, 0, "one\ntwo\n", tcell.StyleDefault)
+			e.ReplaceRange(Position{0, 1}, Position{1, 1}, "X", tcell.StyleDefault)
+			e.Undo()
+			assert.Equal(t, []ChangeEvent{
+				{Start: Position{0, 0}, End: Position{0, 0}, NewEnd: Position{2, 0}, Text: "one\ntwo\n", Version: 1},
+				{Start: Position{0, 1}, End: Position{1, 1}, NewEnd: Position{0, 2}, OldText: "ne\nt", Text: "X", Version: 2},
+				{Start: Position{0, 1}, End: Position{0, 2}, NewEnd: Position{1, 1}, OldText: "X", Text: "ne\nt", Version: 3},
+			}, events)
+			assert.Equal(t, 3, e.Version())
+
+			e.Unsubscribe(id)
+			e.DeleteLine(0)
+			assert.Len(t, events, 3)
+			assert.Equal(t, 4, e.Version())
+		})
+	}
+}
+
+func TestCursors(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertText(0, 0, "foo := 1\nbar := foo\nfoo(bar)\n", tcell.StyleDefault)
+			c := NewCursors(e, Position{0, 0})
+
+			// type on three lines at once
+			c.AddBelow()
+			c.AddBelow()
+			assert.Len(t, c.Selections(), 3)
+			c.Insert("//", tcell.StyleDefault)
+			assert.Equal(t, []string{"//foo := 1", "//bar := foo", "//foo(bar)"}, allLines(e))
+			c.Backspace()
+			c.Move(0, 1, false)
+			c.Backspace()
+			assert.Equal(t, []string{"/oo := 1", "/ar := foo", "/oo(bar)"}, allLines(e))
+
+			// all of it is one undo step each
+			e.Undo()
+			e.Undo()
+			e.Undo()
+			assert.Equal(t, []string{"foo := 1", "bar := foo", "foo(bar)"}, allLines(e))
+
+			// select every foo
+			c.Reset(Position{0, 1})
+			assert.True(t, c.AddNextOccurrence())
+			assert.True(t, c.AddNextOccurrence())
+			assert.True(t, c.AddNextOccurrence())
+			assert.False(t, c.AddNextOccurrence())
+			assert.Equal(t, []string{"foo", "foo", "foo"}, c.Texts())
+			c.Insert("baz", tcell.StyleDefault)
+			assert.Equal(t, []string{"baz := 1", "bar := baz", "baz(bar)"}, allLines(e))
+
+			// selections right next to each other
+			e.InsertText(3, 0, "aaaa", tcell.StyleDefault)
+			c.Set([]Selection{{Head: Position{3, 2}, Tail: Position{3, 0}}, {Head: Position{3, 4}, Tail: Position{3, 2}}})
+			c.Insert("X", tcell.StyleDefault)
+			assert.Equal(t, "XX", allLines(e)[3])
+			e.Undo()
+			e.Undo()
+
+			// cut and paste one piece per cursor
+			c.Reset(Position{0, 0})
+			c.AddBelow()
+			c.Move(0, 3, true)
+			assert.Equal(t, []string{"baz", "bar"}, c.Cut())
+			c.Move(1, 0, false)
+			c.InsertEach([]string{"1", "2"}, tcell.StyleDefault)
+			assert.Equal(t, []string{" := 1", "1 := baz", "2baz(bar)"}, allLines(e))
+
+			// one selection becomes one per line
+			c.Reset(Position{0, 2})
+			c.Move(2, 0, true)
+			c.SplitLines()
+			assert.Equal(t, []string{"= 1", "1 := baz", "2b"}, c.Texts())
+			c.Delete()
+			assert.Equal(t, []string{" :", "", "az(bar)"}, allLines(e))
+			c.Collapse()
+			assert.Len(t, c.Selections(), 1)
+		})
+	}
+}
+
+func TestManyCursors(t *testing.T) {
+	// merging takes a sort, not a comparison of every pair of cursors
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertText(0, 0, strings.Repeat("line\n", 3000), tcell.StyleDefault)
+			c := NewCursors(e, Position{0, 0})
+			c.Set([]Selection{{Head: Position{3000, 0}, Tail: Position{0, 0}}})
+			c.SplitLines()
+			assert.Len(t, c.Selections(), 3000)
+			assert.Equal(t, Selection{Head: Position{2999, 4}, Tail: Position{2999, 0}}, c.Primary())
+			c.Insert("x", tcell.StyleDefault)
+			lines := allLines(e)
+			assert.Len(t, lines, 3000)
+			assert.Equal(t, "x", lines[0])
+			assert.Equal(t, "x", lines[2999])
+
+			// of overlapping selections the one added last stays
+			c.Set([]Selection{
+				{Head: Position{0, 1}, Tail: Position{0, 0}},
+				{Head: Position{1, 0}, Tail: Position{1, 0}},
+				{Head: Position{0, 1}, Tail: Position{0, 0}},
+			})
+			assert.Len(t, c.Selections(), 2)
+			assert.Equal(t, Selection{Head: Position{0, 1}, Tail: Position{0, 0}}, c.Primary())
+		})
+	}
+}
+
+func TestVisualColumns(t *testing.T) {
+	line := []rune("a\tbc\td")
+	for column, visual := range []int{0, 1, 4, 5, 6, 8, 9, 10} {
+		assert.Equal(t, visual, VisualColumn(line, column, 4), "column %d", column)
+	}
+	for visual, column := range []int{0, 1, 1, 1, 2, 3, 4, 4, 5, 6, 6} {
+		assert.Equal(t, column, RuneColumn(line, visual, 4), "visual %d", visual)
+	}
+}
+
+func TestBlockSelection(t *testing.T) {
+	for name, newEditor := range implementations {
+		t.Run(name, func(t *testing.T) {
+			e := newEditor()
+			e.InsertText(0, 0, "a := 1\n\tb := 2\nc\nddd := 4\n", tcell.StyleDefault)
+			c := NewCursors(e, Position{0, 0})
+			c.TabWidth = 4
+
+			// visual columns 2 to 4 on every line, the tab of the second line
+			// covers them all and the third line is too short
+			c.SelectBlock(Position{0, 2}, Position{3, 4})
+			assert.True(t, c.InBlock())
+			assert.Equal(t, []string{":=", "\t", "", "d "}, c.Texts())
+
+			c.Delete()
+			assert.Equal(t, []string{"a  1", "b := 2", "c", "dd:= 4"}, allLines(e))
+			e.Undo()
+
+			// typing pads the short line so everything lines up
+			c.ExtendBlock(0, 0)
+			c.SelectBlock(Position{0, 5}, Position{3, 5})
+			c.Insert("|", tcell.StyleDefault)
+			assert.Equal(t, []string{"a := |1", "\tb| := 2", "c    |", "ddd :|= 4"}, allLines(e))
+			assert.False(t, c.InBlock())
+			e.Undo()
+
+			// growing a block from the cursor with the keyboard
+			c.Reset(Position{0, 1})
+			c.ExtendBlock(1, 1)
+			c.ExtendBlock(1, 0)
+			assert.Equal(t, []string{" ", "", ""}, c.Texts())
+			c.Backspace()
+			assert.Equal(t, []string{"a:= 1", "\tb := 2", "c", "ddd := 4"}, allLines(e))
+
+			c.Reset(Position{2, 1})
+			c.PasteBlock([]string{"x", "y", "z"}, tcell.StyleDefault)
+			assert.Equal(t, []string{"a:= 1", "\tb := 2", "cx", "dydd := 4", " z"}, allLines(e))
+			e.Undo()
+			assert.Equal(t, []string{"a:= 1", "\tb := 2", "c", "ddd := 4"}, allLines(e))
+		})
+	}
+}
+
+func TestSearch(t *testing.T) {
+	e := NewDirtSimpleEditor()
+	e.InsertText(0, 0, "Foo foobar\nfoo_x = foo\nbär foo\n", tcell.StyleDefault)
+
+	s, err := NewSearch("foo", SearchOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 3}, {4, 7}}, s.Line([]rune("Foo foobar")))
+	assert.Len(t, s.All(e, 0, e.Length()), 5)
+
+	s, _ = NewSearch("foo", SearchOptions{CaseSensitive: true, WholeWord: true})
+	assert.Equal(t, []Match{{Position{1, 8}, Position{1, 11}}, {Position{2, 4}, Position{2, 7}}}, s.All(e, 0, e.Length()))
+
+	// columns count runes, not bytes
+	s, _ = NewSearch(`b.r\b`, SearchOptions{Regexp: true})
+	assert.Equal(t, []Match{{Position{0, 7}, Position{0, 10}}, {Position{2, 0}, Position{2, 3}}}, s.All(e, 0, e.Length()))
+
+	// forward and backward, going around the ends
+	s, _ = NewSearch("foo", SearchOptions{CaseSensitive: true})
+	m, ok := s.Next(e, Position{1, 1}, false)
+	assert.True(t, ok)
+	assert.Equal(t, Position{1, 8}, m.Start)
+	m, _ = s.Next(e, Position{2, 5}, false)
+	assert.Equal(t, Position{0, 4}, m.Start)
+	m, _ = s.Next(e, Position{1, 8}, true)
+	assert.Equal(t, Position{1, 0}, m.Start)
+	m, _ = s.Next(e, Position{0, 4}, true)
+	assert.Equal(t, Position{2, 4}, m.Start)
+	m, _ = s.Next(e, Position{0, 5}, true)
+	assert.Equal(t, Position{0, 4}, m.Start)
+
+	_, ok = s.Next(NewDirtSimpleEditor(), Position{}, false)
+	assert.False(t, ok)
+	_, err = NewSearch("(", SearchOptions{Regexp: true})
+	assert.Error(t, err)
+
+	// replacements expand groups only for a regular expression
+	s, _ = NewSearch(`(\w+)\.(\w+)`, SearchOptions{Regexp: true})
+	assert.Equal(t, []string{"b_a", "d_c"}, s.Replacements([]rune("a.b + c.d"), "${2}_$1"))
+	s, _ = NewSearch("a.b", SearchOptions{})
+	assert.Equal(t, []string{"$1"}, s.Replacements([]rune("a.b + c.d"), "$1"))
+}
+
+func TestMerge3(t *testing.T) {
+	base := []string{"a", "b", "c", "d", "e"}
+	merged, conflicts := Merge3(base,
+		[]string{"a", "B", "c", "d", "e", "f"},
+		[]string{"0", "a", "b", "c", "e"},
+		"ours", "theirs")
+	assert.Equal(t, []string{"0", "a", "B", "c", "e", "f"}, merged)
+	assert.Equal(t, 0, conflicts)
+
+	// the same change on both sides is no conflict, different ones are
+	merged, conflicts = Merge3(base,
+		[]string{"a", "x", "c", "D", "e"},
+		[]string{"a", "x", "c", "d2", "e"},
+		"ours", "theirs")
+	assert.Equal(t, []string{"a", "x", "c", "<<<<<<< ours", "D", "=======", "d2", ">>>>>>> theirs", "e"}, merged)
+	assert.Equal(t, 1, conflicts)
+
+	merged, conflicts = Merge3(nil, []string{"x"}, nil, "ours", "theirs")
+	assert.Equal(t, []string{"x"}, merged)
+	assert.Equal(t, 0, conflicts)
+}
+
+func TestMerge3Regenerated(t *testing.T) {
+	// every line changed on one side is a single conflict, found in bounded
+	// time and space
+	base := make([]string, 10000)
+	theirs := make([]string, len(base))
+	for i := range base {
+		base[i] = fmt.Sprint("line ", i)
+		theirs[i] = fmt.Sprint("regenerated ", i)
+	}
+	ours := slices.Clone(base)
+	ours[0] = "edited"
+	merged, conflicts := Merge3(base, ours, theirs, "ours", "theirs")
+	assert.Equal(t, 1, conflicts)
+	assert.Len(t, merged, 3+len(ours)+len(theirs))
+
+	// lines the same on both sides are still paired when some are
+	for i := range theirs {
+		if i%3 == 0 {
+			theirs[i] = base[i]
+		}
+	}
+	match := matchLines(base, theirs)
+	for i, j := range match {
+		if j >= 0 {
+			assert.Equal(t, base[i], theirs[j])
+		}
+	}
+	assert.Equal(t, 0, match[0])
+}
+
+func TestDiff(t *testing.T) {
+	assert.Equal(t, []string{"+0", " a", "-b", "+B", " c", "+d"},
+		Diff([]string{"a", "b", "c"}, []string{"0", "a", "B", "c", "d"}))
+	assert.Empty(t, Diff(nil, nil))
+}
+
+func TestMatchLines(t *testing.T) {
+	// the pairs have to be of equal lines, in order, and as many as the
+	// longest common subsequence has
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a := make([]string, r.Intn(12))
+		b := make([]string, r.Intn(12))
+		for j := range a {
+			a[j] = string(rune('a' + r.Intn(4)))
+		}
+		for j := range b {
+			b[j] = string(rune('a' + r.Intn(4)))
+		}
+		match := matchLines(a, b)
+		count, last := 0, -1
+		for j, k := range match {
+			if k >= 0 {
+				assert.Equal(t, a[j], b[k])
+				assert.Greater(t, k, last)
+				last = k
+				count++
+			}
+		}
+		lcs := make([][]int, len(a)+1)
+		for j := range lcs {
+			lcs[j] = make([]int, len(b)+1)
+		}
+		for j := len(a) - 1; j >= 0; j-- {
+			for k := len(b) - 1; k >= 0; k-- {
+				if a[j] == b[k] {
+					lcs[j][k] = lcs[j+1][k+1] + 1
+				} else {
+					lcs[j][k] = max(lcs[j+1][k], lcs[j][k+1])
+				}
+			}
+		}
+		assert.Equal(t, lcs[0][0], count, "%q %q", a, b)
+	}
+}
+
+func TestRopeIsPersistent(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	var versions []*Rope
+	var models [][]string
+	rope := NewRope()
+	var model []string
+	for i := 0; i < 2000; i++ {
+		switch n := len(model); {
+		case n == 0 || rnd.Intn(3) == 0:
+			at := rnd.Intn(n + 1)
+			text := fmt.Sprint(i)
+			rope = rope.InsertLine(at, text, tcell.StyleDefault)
+			model = slices.Insert(slices.Clone(model), at, text)
+		case rnd.Intn(2) == 0:
+			at := rnd.Intn(n)
+			rope = rope.DeleteLine(at)
+			model = slices.Delete(slices.Clone(model), at, at+1)
+		default:
+			at := rnd.Intn(n)
+			rope = rope.InsertChar(at, 0, 'x', tcell.StyleDefault)
+			model = slices.Clone(model)
+			model[at] = "x" + model[at]
+		}
+		versions = append(versions, rope)
+		models = append(models, model)
+	}
+	// every old version still holds the text it had
+	for v, rope := range versions {
+		assert.Equal(t, len(models[v]), rope.Length())
+		for l, want := range models[v] {
+			text, _ := rope.GetLine(l)
+			if !assert.Equal(t, want, string(text)) {
+				return
+			}
+		}
+		assert.True(t, checkRopeBalanced(rope.root))
+	}
+}
+
+func TestRopeSplitConcat(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	lines := func(from, to int) []StyledLine {
+		var rtn []StyledLine
+		for i := from; i < to; i++ {
+			rtn = append(rtn, makeStyledLine(nil, fmt.Sprint(i)))
+		}
+		return rtn
+	}
+	rope := NewRope().InsertLines(0, lines(0, 1000))
+	var model []string
+	for i := 0; i < 1000; i++ {
+		model = append(model, fmt.Sprint(i))
+	}
+	for i := 0; i < 500; i++ {
+		n := len(model)
+		if rnd.Intn(2) == 0 {
+			// cut a block and paste it somewhere else
+			from := rnd.Intn(n + 1)
+			to := from + rnd.Intn(n-from+1)
+			head, rest := rope.Split(from)
+			block, tail := rest.Split(to - from)
+			rope = head.Concat(tail)
+			at := rnd.Intn(rope.Length() + 1)
+			head, tail = rope.Split(at)
+			rope = head.Concat(block).Concat(tail)
+
+			cut := slices.Clone(model[from:to])
+			model = slices.Delete(model, from, to)
+			model = slices.Insert(model, at, cut...)
+		} else {
+			from := rnd.Intn(n + 1)
+			to := from + rnd.Intn(min(n-from, 50)+1)
+			block := lines(i*1000, i*1000+rnd.Intn(100))
+			rope = rope.DeleteLines(from, to).InsertLines(from, block)
+			model = slices.Delete(model, from, to)
+			for j, l := range block {
+				r, _ := splitStyled(l)
+				model = slices.Insert(model, from+j, string(r))
+			}
+		}
+		if !assert.True(t, checkRopeBalanced(rope.root)) || !assert.Equal(t, len(model), rope.Length()) {
+			return
+		}
+	}
+	for l, want := range model {
+		text, _ := rope.GetLine(l)
+		assert.Equal(t, want, string(text))
+	}
+}
+
+func TestRopeEditorSnapshot(t *testing.T) {
+	e := NewRopeEditor().(*RopeEditor)
+	e.InsertLine(0, "one")
+	snapshot := e.Snapshot()
+	e.InsertLine(1, "two")
+	e.DeleteLine(0)
+	assert.Equal(t, 1, snapshot.Length())
+	text, _ := snapshot.GetLine(0)
+	assert.Equal(t, "one", string(text))
+
+	// undo takes the lines back from the old root
+	e.Undo()
+	e.Undo()
+	assert.Equal(t, 1, e.Length())
+	again, _ := e.Snapshot().GetLine(0)
+	assert.Same(t, &text[0], &again[0])
+}
+
+func checkRopeBalanced(n *RopeNode) bool {
+	if n == nil {
+		return true
+	}
+	bf := balanceFactor(n)
+	if n.height != max(getHeight(n.left), getHeight(n.right))+1 || n.lineCount != getLineCount(n.left)+getLineCount(n.right)+1 {
+		return false
+	}
+	return bf >= -1 && bf <= 1 && checkRopeBalanced(n.left) && checkRopeBalanced(n.right)
+}
+
+func documentOf(e Editor) *document {
+	switch e := e.(type) {
+	case *DirtSimpleEditor:
+		return &e.document
+	case *PieceTableEditor:
+		return &e.document
+	case *RopeEditor:
+		return &e.document
+	}
+	panic("unknown editor")
+}
@@ -0,0 +1,434 @@
+// Package editorstest checks that an editors.Editor implementation behaves like
+// the others.  Edits are made to the implementation and to a trivial reference
+// model side by side, and the text and styles of both are compared after every
+// one of them.
+//
+// An implementation plugs in with
+//
+//	func TestConformance(t *testing.T) { editorstest.Run(t, NewMyEditor) }
+//	func FuzzMyEditor(f *testing.F)    { editorstest.Fuzz(f, NewMyEditor) }
+package editorstest
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+var styles = []tcell.Style{
+	tcell.StyleDefault,
+	tcell.StyleDefault.Foreground(tcell.ColorRed),
+	tcell.StyleDefault.Foreground(tcell.ColorBlue).Bold(true),
+}
+
+type opKind int
+
+const (
+	insertLine opKind = iota
+	insertChar
+	insertNewline
+	deleteChar
+	deleteLine
+	insertText
+	getText
+	deleteRange
+	replaceRange
+	applyStyle
+	undo
+	redo
+	beginTransaction
+	endTransaction
+	numOps
+)
+
+// op is one call made to the editor.
+type op struct {
+	kind       opKind
+	line       int
+	column     int
+	char       rune
+	length     int
+	text       string
+	style      tcell.Style
+	start, end editors.Position // for the range operations
+}
+
+func (o op) String() string {
+	switch o.kind {
+	case insertLine:
+		return fmt.Sprintf("InsertLine(%d, %q)", o.line, o.text)
+	case insertChar, insertNewline:
+		return fmt.Sprintf("InsertChar(%d, %d, %q)", o.line, o.column, o.char)
+	case deleteChar:
+		return fmt.Sprintf("DeleteChar(%d, %d)", o.line, o.column)
+	case deleteLine:
+		return fmt.Sprintf("DeleteLine(%d)", o.line)
+	case insertText:
+		return fmt.Sprintf("InsertText(%d, %d, %q)", o.line, o.column, o.text)
+	case getText:
+		return fmt.Sprintf("GetText(%v, %v)", o.start, o.end)
+	case deleteRange:
+		return fmt.Sprintf("DeleteRange(%v, %v)", o.start, o.end)
+	case replaceRange:
+		return fmt.Sprintf("ReplaceRange(%v, %v, %q)", o.start, o.end, o.text)
+	case applyStyle:
+		return fmt.Sprintf("ApplyStyle(%d, %d, %d, %v)", o.line, o.column, o.length, o.style)
+	case undo:
+		return "Undo()"
+	case redo:
+		return "Redo()"
+	case beginTransaction:
+		return "BeginTransaction()"
+	}
+	return "EndTransaction()"
+}
+
+// Run checks an Editor implementation against the reference model, with a few
+// hand written cases and many random edit sequences.
+func Run(t *testing.T, newEditor func() editors.Editor) {
+	t.Run("Cases", func(t *testing.T) {
+		for name, ops := range cases {
+			t.Run(name, func(t *testing.T) {
+				check(t, newEditor(), ops)
+			})
+		}
+	})
+	t.Run("Random", func(t *testing.T) {
+		for seed := int64(0); seed < 50; seed++ {
+			rnd := rand.New(rand.NewSource(seed))
+			data := make([]byte, 2000)
+			rnd.Read(data)
+			if !check(t, newEditor(), nil, data...) {
+				t.Logf("seed %d", seed)
+				return
+			}
+		}
+	})
+}
+
+// Fuzz runs random edit sequences, generated from the fuzzer's input, against
+// an Editor implementation and the reference model.
+func Fuzz(f *testing.F, newEditor func() editors.Editor) {
+	f.Add([]byte{0, 0, 3, 'a', 1, 0, 0, 'b', 2, 0, 1, 6, 6, 7})
+	f.Add([]byte{5, 0, 0, 'x', 8, 1, 0, 1, 'y', 2, 0, 0, 9, 6, 7, 7})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		check(t, newEditor(), nil, data...)
+	})
+}
+
+var cases = map[string][]op{
+	"InsertLine": {
+		{kind: insertLine, line: 0, text: "foo"},
+		{kind: insertLine, line: 0, text: "bar", style: styles[1]},
+		{kind: insertLine, line: 2, text: ""},
+	},
+	"SplitLine": {
+		{kind: insertLine, line: 0, text: "hello world", style: styles[1]},
+		{kind: insertNewline, line: 0, column: 5, char: '\n'},
+		{kind: insertNewline, line: 1, column: 0, char: '\n'},
+		{kind: insertNewline, line: 2, column: 6, char: '\n'},
+	},
+	"JoinLines": {
+		{kind: insertLine, line: 0, text: "foo"},
+		{kind: insertLine, line: 1, text: "bar", style: styles[2]},
+		{kind: deleteChar, line: 0, column: 3},
+		{kind: deleteChar, line: 0, column: 0},
+	},
+	"DeleteLine": {
+		{kind: deleteLine, line: 0},
+		{kind: insertLine, line: 0, text: "foo"},
+		{kind: insertLine, line: 1, text: "bar"},
+		{kind: deleteLine, line: 0},
+		{kind: deleteLine, line: 0},
+		{kind: undo},
+	},
+	"InsertText": {
+		{kind: insertLine, line: 0, text: "foo"},
+		{kind: insertText, line: 0, column: 1, text: "bar", style: styles[1]},
+		{kind: insertText, line: 1, column: 0, text: "baz"},
+		{kind: insertText, line: 0, column: 2, text: "one\ntwo\n", style: styles[2]},
+	},
+	"Ranges": {
+		{kind: insertText, line: 0, column: 0, text: "one\ntwo\nthree"},
+		{kind: getText, start: editors.Position{Line: 0, Column: 1}, end: editors.Position{Line: 3}},
+		{kind: replaceRange, start: editors.Position{Line: 0, Column: 1}, end: editors.Position{Line: 1, Column: 2}, text: "x\ny", style: styles[1]},
+		{kind: deleteRange, start: editors.Position{Line: 1}, end: editors.Position{Line: 2, Column: 1}},
+		{kind: replaceRange, start: editors.Position{Line: 1, Column: 1}, end: editors.Position{Line: 2}, text: "end"},
+		{kind: undo},
+	},
+	"UndoRedo": {
+		{kind: insertLine, line: 0, text: "foo", style: styles[2]},
+		{kind: insertChar, line: 0, column: 3, char: '!', style: styles[1]},
+		{kind: undo},
+		{kind: undo},
+		{kind: undo},
+		{kind: redo},
+		{kind: insertChar, line: 0, column: 0, char: '>'},
+		{kind: redo},
+		{kind: undo},
+		{kind: redo},
+	},
+	"ApplyStyle": {
+		{kind: insertText, line: 0, column: 0, text: "one\ntwo\nthree\n"},
+		{kind: insertChar, line: 0, column: 3, char: '!'},
+		{kind: applyStyle, line: 2, column: 0, length: 5, style: styles[1]},
+		{kind: applyStyle, line: 0, column: 1, length: 1, style: styles[2]},
+		{kind: undo},
+		{kind: redo},
+		{kind: replaceRange, start: editors.Position{Line: 0, Column: 2}, end: editors.Position{Line: 1, Column: 1}, text: "x\ny"},
+		{kind: applyStyle, line: 0, column: 0, length: 5, style: styles[2]},
+		{kind: applyStyle, line: 1, column: 0, length: 5, style: styles[1]},
+		{kind: undo},
+		{kind: redo},
+		{kind: undo},
+		{kind: undo},
+	},
+	"Transaction": {
+		{kind: beginTransaction},
+		{kind: insertLine, line: 0, text: "foo"},
+		{kind: beginTransaction},
+		{kind: insertNewline, line: 0, column: 1, char: '\n'},
+		{kind: endTransaction},
+		{kind: deleteChar, line: 1, column: 0},
+		{kind: endTransaction},
+		{kind: undo},
+		{kind: redo},
+	},
+}
+
+// check runs ops, and then the ops decoded from data, against the editor and
+// the model.  It reports whether they agreed all along.
+func check(t *testing.T, e editors.Editor, ops []op, data ...byte) (ok bool) {
+	t.Helper()
+	m := &model{}
+	var done []op
+	defer func() {
+		if r := recover(); r != nil {
+			t.Errorf("%v panicked: %v\nafter %v", done[len(done)-1], r, done[:len(done)-1])
+			ok = false
+		}
+	}()
+	mirror := &mirror{version: e.Version()}
+	e.Subscribe(mirror.apply)
+	in := input(data)
+	for len(ops) > 0 || len(in) > 0 {
+		var o op
+		if len(ops) > 0 {
+			o, ops = ops[0], ops[1:]
+		} else {
+			o = in.next(m)
+		}
+		done = append(done, o)
+		if !apply(t, e, m, o) || !compare(t, e, m, done) {
+			return false
+		}
+		if mirror.err != nil || string(mirror.text) != m.text(editors.Position{}, editors.Position{Line: len(m.lines)}) {
+			t.Errorf("after %v\nchange events built %q: %v", done, string(mirror.text), mirror.err)
+			return false
+		}
+	}
+	return true
+}
+
+// mirror rebuilds the text from the change events alone.
+type mirror struct {
+	text    []rune
+	version int
+	err     error
+}
+
+func (m *mirror) apply(ev editors.ChangeEvent) {
+	offset := func(p editors.Position) int {
+		line, i := 0, 0
+		for ; line < p.Line && i < len(m.text); i++ {
+			if m.text[i] == '\n' {
+				line++
+			}
+		}
+		return i + p.Column
+	}
+	from, to := offset(ev.Start), offset(ev.End)
+	switch {
+	case m.err != nil:
+	case ev.Version != m.version+1:
+		m.err = fmt.Errorf("version %d followed %d", ev.Version, m.version)
+	case from > to || to > len(m.text) || string(m.text[from:to]) != ev.OldText:
+		m.err = fmt.Errorf("%+v doesn't match the text", ev)
+	default:
+		m.text = slices.Replace(m.text, from, to, []rune(ev.Text)...)
+		m.version = ev.Version
+		if offset(ev.NewEnd) != from+len([]rune(ev.Text)) {
+			m.err = fmt.Errorf("%+v has the wrong NewEnd", ev)
+		}
+	}
+}
+
+func apply(t *testing.T, e editors.Editor, m *model, o op) bool {
+	t.Helper()
+	switch o.kind {
+	case insertLine:
+		e.InsertLine(o.line, o.text, o.style)
+		m.insertLine(o.line, o.text, o.style)
+	case insertChar, insertNewline:
+		e.InsertChar(o.line, o.column, o.char, o.style)
+		m.insertChar(o.line, o.column, o.char, o.style)
+	case deleteChar:
+		e.DeleteChar(o.line, o.column)
+		m.deleteChar(o.line, o.column)
+	case deleteLine:
+		e.DeleteLine(o.line)
+		m.deleteLine(o.line)
+	case insertText:
+		e.InsertText(o.line, o.column, o.text, o.style)
+		m.insertText(o.line, o.column, o.text, o.style)
+	case getText:
+		if got, want := e.GetText(o.start, o.end), m.text(o.start, o.end); got != want {
+			t.Errorf("%v = %q, want %q", o, got, want)
+			return false
+		}
+	case deleteRange:
+		e.DeleteRange(o.start, o.end)
+		m.deleteRange(o.start, o.end)
+	case replaceRange:
+		got := e.ReplaceRange(o.start, o.end, o.text, o.style)
+		if want := m.replace(o.start, o.end, o.text, o.style); got != want {
+			t.Errorf("%v returned %v, want %v", o, got, want)
+			return false
+		}
+	case applyStyle:
+		e.ApplyStyle(o.line, o.column, o.length, o.style)
+		m.applyStyle(o.line, o.column, o.length, o.style)
+	case undo:
+		if _, ok := e.Undo(); ok != m.undo() {
+			t.Errorf("Undo() returned %v", ok)
+			return false
+		}
+	case redo:
+		if _, ok := e.Redo(); ok != m.redo() {
+			t.Errorf("Redo() returned %v", ok)
+			return false
+		}
+	case beginTransaction:
+		e.BeginTransaction(editors.Position{})
+		m.begin()
+	case endTransaction:
+		e.EndTransaction(editors.Position{})
+		m.end()
+	}
+	return true
+}
+
+func compare(t *testing.T, e editors.Editor, m *model, done []op) bool {
+	t.Helper()
+	if e.Length() != len(m.lines) {
+		t.Errorf("after %v\nLength() = %d, want %d", done, e.Length(), len(m.lines))
+		return false
+	}
+	for l, want := range m.lines {
+		text, style := e.GetLine(l)
+		if string(text) != string(want.text) || !slices.Equal(style, want.styles) {
+			t.Errorf("after %v\nline %d = %q %v, want %q %v", done, l, string(text), style, string(want.text), want.styles)
+			return false
+		}
+	}
+	return true
+}
+
+// input turns fuzzer bytes into valid operations for the model's current text.
+type input []byte
+
+func (in *input) byte() int {
+	if len(*in) == 0 {
+		return 0
+	}
+	b := (*in)[0]
+	*in = (*in)[1:]
+	return int(b)
+}
+
+func (in *input) intn(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return in.byte() % n
+}
+
+// text returns a few characters, if multiline is set newlines are among them.
+func (in *input) text(multiline bool) string {
+	var b strings.Builder
+	for n := in.intn(6); n > 0; n-- {
+		if multiline && in.intn(4) == 0 {
+			b.WriteRune('\n')
+		} else {
+			b.WriteRune(in.char())
+		}
+	}
+	return b.String()
+}
+
+// position returns a valid position in the model's text.
+func (in *input) position(m *model) editors.Position {
+	line := in.intn(len(m.lines) + 1)
+	if line == len(m.lines) {
+		return editors.Position{Line: line}
+	}
+	return editors.Position{Line: line, Column: in.intn(len(m.lines[line].text) + 1)}
+}
+
+func (in *input) char() rune {
+	const chars = "abcxyz 世界\t"
+	return []rune(chars)[in.intn(len([]rune(chars)))]
+}
+
+func (in *input) next(m *model) op {
+	o := op{kind: opKind(in.intn(int(numOps)))}
+	n := len(m.lines)
+	if n == 0 && (o.kind == insertChar || o.kind == insertNewline || o.kind == deleteChar) {
+		o.kind = insertLine
+	}
+	o.style = styles[in.intn(len(styles))]
+	switch o.kind {
+	case insertLine:
+		o.line = in.intn(n + 1)
+		o.text = in.text(false)
+	case insertChar, insertNewline:
+		o.line = in.intn(n)
+		o.column = in.intn(len(m.lines[o.line].text) + 1)
+		o.char = '\n'
+		if o.kind == insertChar {
+			o.char = in.char()
+		}
+	case deleteChar:
+		o.line = in.intn(n)
+		length := len(m.lines[o.line].text)
+		o.column = in.intn(length + 1)
+		if o.column == length && o.line+1 == n {
+			// nothing to join with
+			o.kind = deleteLine
+		}
+	case deleteLine:
+		o.line = in.intn(max(n, 1))
+	case insertText:
+		p := in.position(m)
+		o.line, o.column = p.Line, p.Column
+		o.text = in.text(true)
+	case getText, deleteRange, replaceRange:
+		o.start, o.end = in.position(m), in.position(m)
+		if o.end.Line < o.start.Line || (o.end.Line == o.start.Line && o.end.Column < o.start.Column) {
+			o.start, o.end = o.end, o.start
+		}
+		o.text = in.text(true)
+	case applyStyle:
+		o.line = in.intn(n)
+		if n > 0 {
+			o.column = in.intn(len(m.lines[o.line].text) + 1)
+		}
+		o.length = in.intn(4)
+	}
+	return o
+}
@@ -0,0 +1,225 @@
+package editorstest
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+type line struct {
+	text   []rune
+	styles []tcell.Style
+}
+
+// model is the reference every implementation is compared to: a plain slice of
+// lines, with undo done by keeping the text every edit removed and inserted.
+// Styles applied after an edit aren't part of it, undo keeps them.
+type model struct {
+	lines []line
+	undos [][]change
+	redos [][]change
+
+	depth int      // nesting of transactions
+	open  []change // the edits of the open transaction
+}
+
+// change is an edit of the text flattened into cells.
+type change struct {
+	from              int
+	removed, inserted []cell
+}
+
+func newLine(text string, style tcell.Style) line {
+	l := line{text: []rune(text)}
+	for range l.text {
+		l.styles = append(l.styles, style)
+	}
+	return l
+}
+
+func (m *model) insertLine(at int, text string, style tcell.Style) {
+	from := m.offset(editors.Position{Line: at})
+	m.splice(from, from, append(newLine(text, style).cells(), cell{char: '\n'}))
+}
+
+func (m *model) insertChar(at, column int, char rune, style tcell.Style) {
+	from := m.offset(editors.Position{Line: at, Column: column})
+	m.splice(from, from, []cell{{char, style}})
+}
+
+func (m *model) deleteChar(at, column int) {
+	from := m.offset(editors.Position{Line: at, Column: column})
+	m.splice(from, from+1, nil)
+}
+
+func (m *model) deleteLine(at int) {
+	if len(m.lines) == 0 {
+		return
+	}
+	m.splice(m.offset(editors.Position{Line: at}), m.offset(editors.Position{Line: at + 1}), nil)
+}
+
+func (m *model) applyStyle(at, column, length int, style tcell.Style) {
+	if at < 0 || at >= len(m.lines) {
+		return
+	}
+	styles := m.lines[at].styles
+	for i := max(column, 0); i < min(column+length, len(styles)); i++ {
+		styles[i] = style
+	}
+}
+
+func (m *model) insertText(at, column int, text string, style tcell.Style) {
+	m.replace(editors.Position{Line: at, Column: column}, editors.Position{Line: at, Column: column}, text, style)
+}
+
+// The range operations work on the text flattened into one slice of cells,
+// every line followed by a newline cell.
+
+type cell struct {
+	char  rune
+	style tcell.Style
+}
+
+func (l line) cells() []cell {
+	var cells []cell
+	for i, r := range l.text {
+		cells = append(cells, cell{r, l.styles[i]})
+	}
+	return cells
+}
+
+func (m *model) flatten() []cell {
+	var cells []cell
+	for _, l := range m.lines {
+		cells = append(cells, l.cells()...)
+		cells = append(cells, cell{char: '\n'})
+	}
+	return cells
+}
+
+func (m *model) unflatten(cells []cell) {
+	m.lines = nil
+	var l line
+	for _, c := range cells {
+		if c.char == '\n' {
+			m.lines = append(m.lines, l)
+			l = line{}
+			continue
+		}
+		l.text = append(l.text, c.char)
+		l.styles = append(l.styles, c.style)
+	}
+	if len(l.text) > 0 {
+		// the last line is always terminated
+		m.lines = append(m.lines, l)
+	}
+}
+
+func (m *model) offset(p editors.Position) int {
+	offset := 0
+	for _, l := range m.lines[:p.Line] {
+		offset += len(l.text) + 1
+	}
+	return offset + p.Column
+}
+
+func (m *model) text(start, end editors.Position) string {
+	var text []rune
+	for _, c := range m.flatten()[m.offset(start):m.offset(end)] {
+		text = append(text, c.char)
+	}
+	return string(text)
+}
+
+func (m *model) deleteRange(start, end editors.Position) {
+	if start != end {
+		m.replace(start, end, "", tcell.StyleDefault)
+	}
+}
+
+// replace returns where the new text ends.
+func (m *model) replace(start, end editors.Position, text string, style tcell.Style) editors.Position {
+	var cells []cell
+	for _, r := range text {
+		cells = append(cells, cell{r, style})
+	}
+	m.splice(m.offset(start), m.offset(end), cells)
+
+	lines := strings.Split(text, "\n")
+	last := utf8.RuneCountInString(lines[len(lines)-1])
+	if len(lines) == 1 {
+		return editors.Position{Line: start.Line, Column: start.Column + last}
+	}
+	return editors.Position{Line: start.Line + len(lines) - 1, Column: last}
+}
+
+// splice replaces the cells from from to to and records it for undo.
+func (m *model) splice(from, to int, cells []cell) {
+	old := m.flatten()
+	kept := len(old) - (to - from)
+	c := change{from: from, removed: slices.Clone(old[from:to])}
+	m.unflatten(slices.Replace(old, from, to, cells...))
+	// terminating the last line may have taken one more cell than given
+	text := m.flatten()
+	c.inserted = text[from : from+len(text)-kept]
+	if m.depth > 0 {
+		m.open = append(m.open, c)
+		return
+	}
+	m.undos = append(m.undos, []change{c})
+	m.redos = nil
+}
+
+func (m *model) begin() {
+	m.depth++
+}
+
+func (m *model) end() {
+	if m.depth == 0 {
+		return
+	}
+	if m.depth--; m.depth == 0 {
+		m.commit()
+	}
+}
+
+func (m *model) commit() {
+	if len(m.open) > 0 {
+		m.undos = append(m.undos, m.open)
+		m.redos = nil
+	}
+	m.depth, m.open = 0, nil
+}
+
+func (m *model) undo() bool {
+	m.commit()
+	if len(m.undos) == 0 {
+		return false
+	}
+	changes := m.undos[len(m.undos)-1]
+	m.undos = m.undos[:len(m.undos)-1]
+	for i := len(changes) - 1; i >= 0; i-- {
+		c := changes[i]
+		m.unflatten(slices.Replace(m.flatten(), c.from, c.from+len(c.inserted), c.removed...))
+	}
+	m.redos = append(m.redos, changes)
+	return true
+}
+
+func (m *model) redo() bool {
+	m.commit()
+	if len(m.redos) == 0 {
+		return false
+	}
+	changes := m.redos[len(m.redos)-1]
+	m.redos = m.redos[:len(m.redos)-1]
+	for _, c := range changes {
+		m.unflatten(slices.Replace(m.flatten(), c.from, c.from+len(c.removed), c.inserted...))
+	}
+	m.undos = append(m.undos, changes)
+	return true
+}
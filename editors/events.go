@@ -0,0 +1,77 @@
+package editors
+
+import "strings"
+
+// ChangeEvent describes a change to the text: the text between Start and End,
+// positions in the text as it was before, was replaced by Text, which now ends
+// at NewEnd.  Undo and redo are reported as changes as well.
+type ChangeEvent struct {
+	Start   Position
+	End     Position
+	NewEnd  Position
+	OldText string
+	Text    string
+	// Version goes up by one with every change.
+	Version int
+}
+
+type subscriber struct {
+	id       int
+	callback func(ChangeEvent)
+}
+
+type subscribers struct {
+	list    []subscriber
+	nextID  int
+	version int
+}
+
+// Subscribe calls callback after every change to the text, on the goroutine
+// making the change, and returns an id for Unsubscribe.
+func (d *document) Subscribe(callback func(ChangeEvent)) int {
+	d.subscribers.nextID++
+	d.subscribers.list = append(d.subscribers.list, subscriber{d.subscribers.nextID, callback})
+	return d.subscribers.nextID
+}
+
+func (d *document) Unsubscribe(id int) {
+	for i, s := range d.subscribers.list {
+		if s.id == id {
+			d.subscribers.list = append(d.subscribers.list[:i:i], d.subscribers.list[i+1:]...)
+			return
+		}
+	}
+}
+
+// Version returns the version of the text, it goes up by one with every change.
+func (d *document) Version() int {
+	return d.subscribers.version
+}
+
+// changed is called after the text between start and end was replaced, it
+// moves the anchors, tells the subscribers and returns the anchors that were
+// in the replaced text.
+func (d *document) changed(start, end Position, removed, inserted []StyledLine) map[int]Position {
+	newEnd := endOf(start, inserted)
+	displaced := d.anchors.moved(start, end, newEnd)
+	d.subscribers.version++
+	if len(d.subscribers.list) > 0 {
+		ev := ChangeEvent{
+			Start:   start,
+			End:     end,
+			NewEnd:  newEnd,
+			OldText: segText(removed),
+			Text:    segText(inserted),
+			Version: d.subscribers.version,
+		}
+		for _, s := range d.subscribers.list {
+			s.callback(ev)
+		}
+	}
+	return displaced
+}
+
+// segText joins segments back into text.
+func segText(segs []StyledLine) string {
+	return strings.Join(segStrings(segs), "\n")
+}
@@ -0,0 +1,206 @@
+package editors
+
+import "time"
+
+// edit is a single replacement made to the text, with enough of the old and
+// new text to undo and redo it.
+type edit struct {
+	start    Position
+	removed  []StyledLine
+	inserted []StyledLine
+
+	displaced map[int]Position // anchors that were inside the replaced text
+
+	// the text before and after the edit, if the storage can keep it
+	before, after any
+}
+
+// state is a node of the undo tree: the text as it was after a step, one edit
+// or all the edits of a transaction, was applied to the parent state.  Undoing
+// and then editing again starts a new branch, nothing is ever thrown away.
+type state struct {
+	id       int
+	parent   *state
+	children []*state
+	redo     *state // the child Redo goes to, the one visited last
+	edits    []edit
+	before   Position // cursor before the step
+	after    Position // cursor after the step
+	time     time.Time
+}
+
+// HistoryState describes a state of the undo tree.
+type HistoryState struct {
+	ID       int
+	Parent   int // -1 for the initial state
+	Children []int
+	Time     time.Time
+	Current  bool
+	Summary  string // the text inserted or removed by the step
+}
+
+// history is the undo tree.
+type history struct {
+	states  []*state // by id, states[0] is the root
+	current *state
+	open    *state // transaction being built, not linked into the tree yet
+	depth   int    // nesting of BeginTransaction calls
+	saved   *state // the state MarkSaved was called in
+	now     func() time.Time
+
+	// snapshot takes the whole text, when the storage is a snapshotter
+	snapshot func() any
+}
+
+func (h *history) init() {
+	if h.states == nil {
+		if h.now == nil {
+			h.now = time.Now
+		}
+		h.current = &state{time: h.now()}
+		h.states = []*state{h.current}
+		h.saved = h.current
+	}
+}
+
+func (h *history) begin(cursor Position) {
+	if h.depth == 0 {
+		h.open = &state{before: cursor}
+	}
+	h.depth++
+}
+
+func (h *history) end(cursor Position) {
+	if h.depth == 0 {
+		return
+	}
+	h.depth--
+	if h.depth == 0 {
+		h.open.after = cursor
+		h.commit()
+	}
+}
+
+// commit adds the open transaction to the tree as a child of the current
+// state, dropping it when nothing was edited.
+func (h *history) commit() {
+	if h.open != nil && len(h.open.edits) > 0 {
+		h.add(h.open)
+	}
+	h.open = nil
+	h.depth = 0
+}
+
+func (h *history) add(s *state) {
+	h.init()
+	s.id = len(h.states)
+	s.parent = h.current
+	s.time = h.now()
+	h.current.children = append(h.current.children, s)
+	h.current.redo = s
+	h.states = append(h.states, s)
+	h.current = s
+}
+
+// record adds an edit to the open transaction, or makes it a step of its own.
+func (h *history) record(e edit) {
+	if h.open != nil {
+		h.open.edits = append(h.open.edits, e)
+		return
+	}
+	h.add(&state{
+		edits:  []edit{e},
+		before: e.start,
+		after:  endOf(e.start, e.inserted),
+	})
+}
+
+// path returns the states to step back out of and the states to step into,
+// in order, to get from the current state to target.
+func (h *history) path(target *state) (up, down []*state) {
+	depth := func(s *state) int {
+		d := 0
+		for ; s.parent != nil; s = s.parent {
+			d++
+		}
+		return d
+	}
+	from, to := h.current, target
+	df, dt := depth(from), depth(to)
+	for ; df > dt; df-- {
+		up = append(up, from)
+		from = from.parent
+	}
+	for ; dt > df; dt-- {
+		down = append(down, to)
+		to = to.parent
+	}
+	for from != to {
+		up = append(up, from)
+		down = append(down, to)
+		from, to = from.parent, to.parent
+	}
+	for i, j := 0, len(down)-1; i < j; i, j = i+1, j-1 {
+		down[i], down[j] = down[j], down[i]
+	}
+	return up, down
+}
+
+// at returns the newest state created at or before t.
+func (h *history) at(t time.Time) *state {
+	h.init()
+	found := h.states[0]
+	for _, s := range h.states {
+		if !s.time.After(t) {
+			found = s
+		}
+	}
+	return found
+}
+
+func (h *history) describe() []HistoryState {
+	h.init()
+	rtn := make([]HistoryState, len(h.states))
+	for i, s := range h.states {
+		rtn[i] = HistoryState{
+			ID:      s.id,
+			Parent:  -1,
+			Time:    s.time,
+			Current: s == h.current,
+			Summary: summarize(s.edits),
+		}
+		if s.parent != nil {
+			rtn[i].Parent = s.parent.id
+		}
+		for _, c := range s.children {
+			rtn[i].Children = append(rtn[i].Children, c.id)
+		}
+	}
+	return rtn
+}
+
+// summarize describes a step by the text it inserted, or failing that the
+// text it removed.
+func summarize(edits []edit) string {
+	var inserted, removed []rune
+	for _, e := range edits {
+		for i, seg := range e.inserted {
+			if i > 0 {
+				inserted = append(inserted, '⏎')
+			}
+			r, _ := splitStyled(seg)
+			inserted = append(inserted, r...)
+		}
+		for i, seg := range e.removed {
+			if i > 0 {
+				removed = append(removed, '⏎')
+			}
+			r, _ := splitStyled(seg)
+			removed = append(removed, r...)
+		}
+	}
+	if len(inserted) > 0 {
+		return "+" + string(inserted[:min(len(inserted), 40)])
+	}
+	return "-" + string(removed[:min(len(removed), 40)])
+}
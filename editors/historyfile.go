@@ -0,0 +1,113 @@
+package editors
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// The undo tree is saved as JSON.  Styles are not kept, restored text gets the
+// default style.
+
+type savedHistory struct {
+	Current int
+	States  []savedState // by id, States[0] is the root
+}
+
+type savedState struct {
+	Parent int // -1 for the root
+	Redo   int // -1 when there is no child to redo
+	Time   time.Time
+	Before Position
+	After  Position
+	Edits  []savedEdit
+}
+
+type savedEdit struct {
+	Start    Position
+	Removed  []string
+	Inserted []string
+}
+
+// WriteHistory saves the undo tree as of the text last saved, which is what the
+// file holds when it is read back.  Edits made since then can be redone.
+func (d *document) WriteHistory(w io.Writer) error {
+	d.history.commit()
+	d.history.init()
+	saved := savedHistory{Current: d.history.saved.id}
+	for _, s := range d.history.states {
+		ss := savedState{Parent: -1, Redo: -1, Time: s.time, Before: s.before, After: s.after}
+		if s.parent != nil {
+			ss.Parent = s.parent.id
+		}
+		if s.redo != nil {
+			ss.Redo = s.redo.id
+		}
+		for _, e := range s.edits {
+			ss.Edits = append(ss.Edits, savedEdit{Start: e.start, Removed: segStrings(e.removed), Inserted: segStrings(e.inserted)})
+		}
+		saved.States = append(saved.States, ss)
+	}
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// ReadHistory replaces the undo tree with one saved by WriteHistory.  The text
+// has to be what it was in the saved current state.
+func (d *document) ReadHistory(r io.Reader) error {
+	var saved savedHistory
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+	if len(saved.States) == 0 || saved.Current < 0 || saved.Current >= len(saved.States) {
+		return fmt.Errorf("undo history has no current state")
+	}
+	states := make([]*state, len(saved.States))
+	for id, ss := range saved.States {
+		s := &state{id: id, time: ss.Time, before: ss.Before, after: ss.After}
+		if (id == 0) != (ss.Parent < 0) || ss.Parent >= id {
+			return fmt.Errorf("undo history state %d has a bad parent %d", id, ss.Parent)
+		}
+		if ss.Parent >= 0 {
+			s.parent = states[ss.Parent]
+			s.parent.children = append(s.parent.children, s)
+		}
+		for _, e := range ss.Edits {
+			s.edits = append(s.edits, edit{start: e.Start, removed: styledSegs(e.Removed), inserted: styledSegs(e.Inserted)})
+		}
+		states[id] = s
+	}
+	for id, ss := range saved.States {
+		if ss.Redo >= 0 {
+			if ss.Redo >= len(states) || states[ss.Redo].parent != states[id] {
+				return fmt.Errorf("undo history state %d has a bad redo %d", id, ss.Redo)
+			}
+			states[id].redo = states[ss.Redo]
+		}
+	}
+	d.history = history{states: states, current: states[saved.Current], now: d.history.now, snapshot: d.history.snapshot}
+	d.history.saved = d.history.current
+	return nil
+}
+
+// ClearHistory forgets every undo state, the text as it is becomes the root.
+func (d *document) ClearHistory() {
+	d.history = history{now: d.history.now, snapshot: d.history.snapshot}
+}
+
+func segStrings(segs []StyledLine) []string {
+	rtn := make([]string, len(segs))
+	for i, seg := range segs {
+		runes, _ := splitStyled(seg)
+		rtn[i] = string(runes)
+	}
+	return rtn
+}
+
+func styledSegs(segs []string) []StyledLine {
+	rtn := make([]StyledLine, len(segs))
+	for i, seg := range segs {
+		rtn[i] = makeStyledLine(nil, seg)
+	}
+	return rtn
+}
@@ -1,11 +1,14 @@
 // Immutable Line-Based Rope Data Structure (Indexed by Line Numbers)
-// Supports efficient insertions, deletions, undo/redo, and balancing.
+// Supports efficient insertions, deletions, undo/redo, and balancing.  Nodes are
+// never changed once built, an edit copies the path from the root to the lines
+// it touches.
 
 package editors
 
 import (
 	"fmt"
 	"github.com/gdamore/tcell/v2"
+	"slices"
 )
 
 // RopeNode represents a node in the immutable rope structure, where each node corresponds to a single line.
@@ -18,7 +21,10 @@ type RopeNode struct {
 	height    int           // Height of the node for balancing
 }
 
-// Rope is the root structure of the line-based rope tree.
+// Rope is the root structure of the line-based rope tree.  A Rope is never
+// modified: every edit returns a new Rope that shares the subtrees the edit
+// didn't touch with the old one, so an old Rope stays valid and can be read from
+// any goroutine without locking.
 type Rope struct {
 	root *RopeNode
 }
@@ -28,6 +34,19 @@ func NewRope() *Rope {
 	return &Rope{root: nil}
 }
 
+// newRopeNode builds a node from its children and line, computing the cached
+// height and line count.
+func newRopeNode(left *RopeNode, text []rune, styles []tcell.Style, right *RopeNode) *RopeNode {
+	return &RopeNode{
+		left:      left,
+		right:     right,
+		text:      text,
+		styles:    styles,
+		lineCount: getLineCount(left) + getLineCount(right) + 1,
+		height:    max(getHeight(left), getHeight(right)) + 1,
+	}
+}
+
 // getLineCount returns the number of lines in a subtree.
 func getLineCount(node *RopeNode) int {
 	if node == nil {
@@ -55,30 +74,17 @@ func balanceFactor(node *RopeNode) int {
 // rotateRight performs a right rotation to balance the tree.
 func rotateRight(y *RopeNode) *RopeNode {
 	x := y.left
-	T2 := x.right
-	x.right = y
-	y.left = T2
-	y.height = max(getHeight(y.left), getHeight(y.right)) + 1
-	x.height = max(getHeight(x.left), getHeight(x.right)) + 1
-	y.lineCount = getLineCount(y.left) + getLineCount(y.right) + 1
-	x.lineCount = getLineCount(x.left) + getLineCount(x.right) + 1
-	return x
+	return newRopeNode(x.left, x.text, x.styles, newRopeNode(x.right, y.text, y.styles, y.right))
 }
 
 // rotateLeft performs a left rotation to balance the tree.
 func rotateLeft(x *RopeNode) *RopeNode {
 	y := x.right
-	T2 := y.left
-	y.left = x
-	x.right = T2
-	x.height = max(getHeight(x.left), getHeight(x.right)) + 1
-	y.height = max(getHeight(y.left), getHeight(y.right)) + 1
-	x.lineCount = getLineCount(x.left) + getLineCount(x.right) + 1
-	y.lineCount = getLineCount(y.left) + getLineCount(y.right) + 1
-	return y
+	return newRopeNode(newRopeNode(x.left, x.text, x.styles, y.left), y.text, y.styles, y.right)
 }
 
-// balance ensures that the tree remains balanced.
+// balance restores the AVL invariant of a node whose children differ in height
+// by at most two.
 func balance(node *RopeNode) *RopeNode {
 	if node == nil {
 		return nil
@@ -88,160 +94,218 @@ func balance(node *RopeNode) *RopeNode {
 
 	if balance > 1 {
 		if balanceFactor(node.left) < 0 {
-			node.left = rotateLeft(node.left)
+			node = newRopeNode(rotateLeft(node.left), node.text, node.styles, node.right)
 		}
 		return rotateRight(node)
 	}
 
 	if balance < -1 {
 		if balanceFactor(node.right) > 0 {
-			node.right = rotateRight(node.right)
+			node = newRopeNode(node.left, node.text, node.styles, rotateRight(node.right))
 		}
 		return rotateLeft(node)
 	}
 
-	node.height = max(getHeight(node.left), getHeight(node.right)) + 1
-	node.lineCount = getLineCount(node.left) + getLineCount(node.right) + 1
 	return node
 }
 
-// GetLine retrieves the text and styles for a given line.
+// Length returns the number of lines.
+func (r *Rope) Length() int {
+	return getLineCount(r.root)
+}
+
+// GetLine retrieves the text and styles for a given line.  They are shared with
+// the rope and must not be modified.
 func (r *Rope) GetLine(line int) ([]rune, []tcell.Style) {
 	return getLineNode(r.root, line)
 }
 
+// InsertLine returns a rope with a new line holding s inserted at index i.
 func (r *Rope) InsertLine(i int, s string, foreground tcell.Style) *Rope {
+	text := []rune(s)
+	styles := make([]tcell.Style, len(text))
+	for j := range styles {
+		styles[j] = foreground
+	}
+	return r.insertLine(i, text, styles)
+}
 
-	// InsertLine inserts a new line with the given text and styles at the specified index `i`.
+func (r *Rope) insertLine(i int, text []rune, styles []tcell.Style) *Rope {
 	if i < 0 || i > getLineCount(r.root) {
 		panic("line index out of bounds")
 	}
-	newNode := &RopeNode{
-		text:      []rune(s),
-		styles:    make([]tcell.Style, len([]rune(s))),
-		lineCount: 1,
-		height:    1,
-	}
-	for j := range newNode.styles {
-		newNode.styles[j] = foreground
-	}
-	r.root = insertLineNode(r.root, i, newNode)
-	return r
+	return &Rope{root: insertLineNode(r.root, i, text, styles)}
 }
 
+// InsertChar returns a rope with the character r inserted at column col of line.
 func (rr *Rope) InsertChar(line int, col int, r rune, foreground tcell.Style) *Rope {
-
-	// InsertChar inserts a character `r` at the specified column `col` in the given line `line`.
 	if line < 0 || line >= getLineCount(rr.root) {
 		panic("line index out of bounds")
 	}
+	text, styles := rr.GetLine(line)
+	if col < 0 || col > len(text) {
+		panic("column index out of bounds")
+	}
+	return rr.setLine(line, slices.Insert(clone(text), col, r), slices.Insert(clone(styles), col, foreground))
+}
 
-	var insertCharNode func(node *RopeNode, line, col int, r rune, style tcell.Style) *RopeNode
-	insertCharNode = func(node *RopeNode, line, col int, r rune, style tcell.Style) *RopeNode {
-		if node == nil {
-			return nil
-		}
+// DeleteLine returns a rope without the given line.
+func (r *Rope) DeleteLine(line int) *Rope {
+	if line < 0 || line >= getLineCount(r.root) {
+		panic("line index out of bounds")
+	}
+	return &Rope{root: deleteLineNode(r.root, line)}
+}
 
-		leftSize := getLineCount(node.left)
-
-		if line < leftSize {
-			node.left = insertCharNode(node.left, line, col, r, style)
-		} else if line > leftSize {
-			node.right = insertCharNode(node.right, line-leftSize-1, col, r, style)
-		} else {
-			// We are at the target line node
-			if col < 0 || col > len(node.text) {
-				panic("column index out of bounds")
-			}
-
-			// Insert character at the correct position
-			newText := make([]rune, len(node.text)+1)
-			copy(newText, node.text[:col])
-			newText[col] = r
-			copy(newText[col+1:], node.text[col:])
-
-			// Insert style for the new character
-			newStyles := make([]tcell.Style, len(node.styles)+1)
-			copy(newStyles, node.styles[:col])
-			newStyles[col] = style
-			copy(newStyles[col+1:], node.styles[col:])
-
-			node.text = newText
-			node.styles = newStyles
-		}
+// setLine returns a rope with the text and styles of a line replaced.
+func (r *Rope) setLine(line int, text []rune, styles []tcell.Style) *Rope {
+	if line < 0 || line >= getLineCount(r.root) {
+		panic("line index out of bounds")
+	}
+	return &Rope{root: setLineNode(r.root, line, text, styles)}
+}
 
-		node.height = max(getHeight(node.left), getHeight(node.right)) + 1
-		node.lineCount = getLineCount(node.left) + getLineCount(node.right) + 1
-		return balance(node)
+// InsertLines returns a rope with lines inserted in front of line at.  The new
+// lines are built into a balanced tree and joined in, so it takes O(k + log n)
+// rather than k rebalancing inserts.
+func (r *Rope) InsertLines(at int, lines []StyledLine) *Rope {
+	if at < 0 || at > getLineCount(r.root) {
+		panic("line index out of bounds")
 	}
+	left, right := splitNode(r.root, at)
+	return &Rope{root: concatNodes(concatNodes(left, buildNodes(lines)), right)}
+}
 
-	rr.root = insertCharNode(rr.root, line, col, r, foreground)
-	return rr
+// DeleteLines returns a rope without the lines from to to (exclusive).
+func (r *Rope) DeleteLines(from, to int) *Rope {
+	if from < 0 || to < from || to > getLineCount(r.root) {
+		panic("line index out of bounds")
+	}
+	left, rest := splitNode(r.root, from)
+	_, right := splitNode(rest, to-from)
+	return &Rope{root: concatNodes(left, right)}
 }
 
-func (r *Rope) DeleteLine(line int) *Rope {
-	if line < 0 || line >= getLineCount(r.root) {
+// Split returns a rope holding the lines in front of line and one holding the
+// rest, in O(log n).
+func (r *Rope) Split(line int) (*Rope, *Rope) {
+	if line < 0 || line > getLineCount(r.root) {
 		panic("line index out of bounds")
 	}
+	left, right := splitNode(r.root, line)
+	return &Rope{root: left}, &Rope{root: right}
+}
 
-	var deleteLineNode func(node *RopeNode, line int) *RopeNode
-	deleteLineNode = func(node *RopeNode, line int) *RopeNode {
-		if node == nil {
-			return nil
-		}
+// Concat returns a rope holding the lines of r followed by those of other, in
+// O(log n).
+func (r *Rope) Concat(other *Rope) *Rope {
+	return &Rope{root: concatNodes(r.root, other.root)}
+}
 
-		leftSize := getLineCount(node.left)
-
-		if line < leftSize {
-			node.left = deleteLineNode(node.left, line)
-		} else if line > leftSize {
-			node.right = deleteLineNode(node.right, line-leftSize-1)
-		} else {
-			// This is the line to delete
-			if node.left == nil {
-				return node.right
-			}
-			if node.right == nil {
-				return node.left
-			}
-
-			// Find the in-order successor (smallest node in the right subtree)
-			successor := node.right
-			for successor.left != nil {
-				successor = successor.left
-			}
-
-			// Replace the current node with the successor
-			node.text = successor.text
-			node.styles = successor.styles
-			node.right = deleteLineNode(node.right, 0)
-		}
+// joinNodes builds the tree holding everything in left, then the line, then
+// everything in right, whatever the heights of left and right.
+func joinNodes(left *RopeNode, text []rune, styles []tcell.Style, right *RopeNode) *RopeNode {
+	switch {
+	case getHeight(left) > getHeight(right)+1:
+		return balance(newRopeNode(left.left, left.text, left.styles, joinNodes(left.right, text, styles, right)))
+	case getHeight(right) > getHeight(left)+1:
+		return balance(newRopeNode(joinNodes(left, text, styles, right.left), right.text, right.styles, right.right))
+	}
+	return newRopeNode(left, text, styles, right)
+}
 
-		node.height = max(getHeight(node.left), getHeight(node.right)) + 1
-		node.lineCount = getLineCount(node.left) + getLineCount(node.right) + 1
-		return balance(node)
+func concatNodes(left, right *RopeNode) *RopeNode {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
 	}
+	rest, text, styles := splitLastNode(left)
+	return joinNodes(rest, text, styles, right)
+}
 
-	r.root = deleteLineNode(r.root, line)
-	return r
+// splitLastNode removes the last line of a non-empty tree.
+func splitLastNode(node *RopeNode) (*RopeNode, []rune, []tcell.Style) {
+	if node.right == nil {
+		return node.left, node.text, node.styles
+	}
+	rest, text, styles := splitLastNode(node.right)
+	return joinNodes(node.left, node.text, node.styles, rest), text, styles
 }
 
-func insertLineNode(node *RopeNode, index int, newNode *RopeNode) *RopeNode {
+// splitNode cuts a tree in front of line.
+func splitNode(node *RopeNode, line int) (*RopeNode, *RopeNode) {
 	if node == nil {
-		return newNode
+		return nil, nil
+	}
+	leftSize := getLineCount(node.left)
+	if line <= leftSize {
+		l, r := splitNode(node.left, line)
+		return l, joinNodes(r, node.text, node.styles, node.right)
+	}
+	l, r := splitNode(node.right, line-leftSize-1)
+	return joinNodes(node.left, node.text, node.styles, l), r
+}
+
+// buildNodes returns a balanced tree holding lines in order.
+func buildNodes(lines []StyledLine) *RopeNode {
+	if len(lines) == 0 {
+		return nil
+	}
+	mid := len(lines) / 2
+	text, styles := splitStyled(lines[mid])
+	return newRopeNode(buildNodes(lines[:mid]), text, styles, buildNodes(lines[mid+1:]))
+}
+
+func insertLineNode(node *RopeNode, index int, text []rune, styles []tcell.Style) *RopeNode {
+	if node == nil {
+		return newRopeNode(nil, text, styles, nil)
 	}
 
 	leftSize := getLineCount(node.left)
 
 	if index <= leftSize {
-		node.left = insertLineNode(node.left, index, newNode)
-	} else {
-		node.right = insertLineNode(node.right, index-leftSize-1, newNode)
+		return balance(newRopeNode(insertLineNode(node.left, index, text, styles), node.text, node.styles, node.right))
 	}
+	return balance(newRopeNode(node.left, node.text, node.styles, insertLineNode(node.right, index-leftSize-1, text, styles)))
+}
 
-	node.height = max(getHeight(node.left), getHeight(node.right)) + 1
-	node.lineCount = getLineCount(node.left) + getLineCount(node.right) + 1
-	return balance(node)
+func deleteLineNode(node *RopeNode, line int) *RopeNode {
+	leftSize := getLineCount(node.left)
+
+	if line < leftSize {
+		return balance(newRopeNode(deleteLineNode(node.left, line), node.text, node.styles, node.right))
+	} else if line > leftSize {
+		return balance(newRopeNode(node.left, node.text, node.styles, deleteLineNode(node.right, line-leftSize-1)))
+	}
+
+	// This is the line to delete
+	if node.left == nil {
+		return node.right
+	}
+	if node.right == nil {
+		return node.left
+	}
+
+	// Take the place of the node with its in-order successor (smallest node in
+	// the right subtree)
+	successor := node.right
+	for successor.left != nil {
+		successor = successor.left
+	}
+	return balance(newRopeNode(node.left, successor.text, successor.styles, deleteLineNode(node.right, 0)))
+}
+
+func setLineNode(node *RopeNode, line int, text []rune, styles []tcell.Style) *RopeNode {
+	leftSize := getLineCount(node.left)
+
+	if line < leftSize {
+		return newRopeNode(setLineNode(node.left, line, text, styles), node.text, node.styles, node.right)
+	} else if line > leftSize {
+		return newRopeNode(node.left, node.text, node.styles, setLineNode(node.right, line-leftSize-1, text, styles))
+	}
+	return newRopeNode(node.left, text, styles, node.right)
 }
 
 func getLineNode(node *RopeNode, line int) ([]rune, []tcell.Style) {
@@ -1,18 +1,80 @@
 package editors
 
-import "github.com/gdamore/tcell/v2"
+import (
+	"io"
+	"time"
+
+	"github.com/gdamore/tcell/v2"
+)
 
 type Editor interface {
 	InsertLine(line int, text string, style ...tcell.Style)
 	InsertChar(line int, column int, text rune, style tcell.Style)
 	DeleteLine(line int)
 	DeleteChar(line int, column int)
-	Subscribe(line int, column int, height int, width int, callback func(line int, column int, char rune, style tcell.Style)) int
+	// Subscribe calls callback after every change to the text, undo and redo
+	// included, on the goroutine making the change.  It returns an id for
+	// Unsubscribe.
+	Subscribe(callback func(ChangeEvent)) int
 	ApplyStyle(line int, column int, length int, style tcell.Style)
 	Unsubscribe(id int)
-	Undo()
-	Redo()
+	// Version goes up by one with every change to the text.
+	Version() int
 	GetLine(line int) ([]rune, []tcell.Style)
+	// InsertText inserts msg, which may span several lines, at column pos of
+	// line.
 	InsertText(line int, pos int, msg string, style tcell.Style)
 	Length() int
+
+	// GetText returns the text between start and end, lines separated by '\n'.
+	GetText(start, end Position) string
+	// DeleteRange removes the text between start and end.
+	DeleteRange(start, end Position)
+	// ReplaceRange replaces the text between start and end with text, which may
+	// span several lines, and returns where the new text ends.
+	ReplaceRange(start, end Position, text string, style tcell.Style) Position
+
+	// AddAnchor creates an anchor at pos and returns its id.  Anchors follow
+	// the text around them through every edit, undo and redo, text inserted
+	// right at an anchor goes in front of it or after it depending on its
+	// gravity.  An anchor inside deleted text ends up where the text was, undo
+	// puts it back.
+	AddAnchor(pos Position, gravity Gravity) int
+	// AnchorPosition returns where an anchor is now, ok is false when there is
+	// no such anchor.
+	AnchorPosition(id int) (pos Position, ok bool)
+	RemoveAnchor(id int)
+
+	// Undo reverts the latest step, a single edit or a whole transaction, and
+	// returns where the cursor was before it.  ok is false when there is
+	// nothing to undo.
+	Undo() (cursor Position, ok bool)
+	// Redo re-applies the step undone last and returns where the cursor was
+	// after it.  Editing after an undo starts a new branch of the undo tree,
+	// the old branch can still be reached through GotoState.
+	Redo() (cursor Position, ok bool)
+	// History lists every state of the undo tree, oldest first.
+	History() []HistoryState
+	// GotoState moves to any state of the undo tree.
+	GotoState(id int) (cursor Position, ok bool)
+	// Earlier and Later move to the state the text was in the given time
+	// before or after the current state.
+	Earlier(d time.Duration) (cursor Position, ok bool)
+	Later(d time.Duration) (cursor Position, ok bool)
+	// BeginTransaction groups every edit up to the matching EndTransaction into
+	// a single undo step.  Transactions nest, only the outermost one counts.
+	BeginTransaction(cursor Position)
+	EndTransaction(cursor Position)
+	// WriteHistory saves the undo tree as of the state MarkSaved was last called
+	// in, ReadHistory puts a saved one back and expects the text to be what it
+	// was in that state.
+	WriteHistory(w io.Writer) error
+	ReadHistory(r io.Reader) error
+	// ClearHistory forgets the undo tree, the text as it is becomes the root.
+	ClearHistory()
+	// MarkSaved records that the text as it is now has been saved, Modified
+	// reports whether it changed since.  Undo and redo back to the saved text
+	// make it unmodified again.
+	MarkSaved()
+	Modified() bool
 }
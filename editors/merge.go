@@ -0,0 +1,175 @@
+package editors
+
+import "slices"
+
+// Merge3 merges the changes two sides made to the same base text, line by
+// line.  Where both sides changed the same lines differently the merged text
+// holds both versions between conflict markers, labelled with the names of
+// the sides.  It returns the merged lines and the number of conflicts.
+func Merge3(base, ours, theirs []string, oursName, theirsName string) ([]string, int) {
+	inOurs := matchLines(base, ours)
+	inTheirs := matchLines(base, theirs)
+	var merged []string
+	conflicts := 0
+	o, a, b := 0, 0, 0
+	for o < len(base) || a < len(ours) || b < len(theirs) {
+		// lines the same on all three
+		for o < len(base) && inOurs[o] == a && inTheirs[o] == b {
+			merged = append(merged, base[o])
+			o, a, b = o+1, a+1, b+1
+		}
+		// up to the next base line both sides kept
+		next := o
+		for next < len(base) && (inOurs[next] < 0 || inTheirs[next] < 0) {
+			next++
+		}
+		aEnd, bEnd := len(ours), len(theirs)
+		if next < len(base) {
+			aEnd, bEnd = inOurs[next], inTheirs[next]
+		}
+		was, mine, their := base[o:next], ours[a:aEnd], theirs[b:bEnd]
+		switch {
+		case slices.Equal(mine, was):
+			merged = append(merged, their...)
+		case slices.Equal(their, was) || slices.Equal(mine, their):
+			merged = append(merged, mine...)
+		default:
+			conflicts++
+			merged = append(merged, "<<<<<<< "+oursName)
+			merged = append(merged, mine...)
+			merged = append(merged, "=======")
+			merged = append(merged, their...)
+			merged = append(merged, ">>>>>>> "+theirsName)
+		}
+		o, a, b = next, aEnd, bEnd
+	}
+	return merged, conflicts
+}
+
+// Diff lists the lines of a and b in order, the ones only in a prefixed with
+// "-", the ones only in b with "+" and the ones in both with " ".
+func Diff(a, b []string) []string {
+	match := matchLines(a, b)
+	var diff []string
+	j := 0
+	for i, line := range a {
+		if match[i] < 0 {
+			diff = append(diff, "-"+line)
+			continue
+		}
+		for ; j < match[i]; j++ {
+			diff = append(diff, "+"+b[j])
+		}
+		diff = append(diff, " "+line)
+		j++
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+"+b[j])
+	}
+	return diff
+}
+
+// matchSteps bounds the work matchLines does: texts too different to be
+// compared in that many steps keep the lines not paired by then unpaired,
+// merging them is a single conflict.
+const matchSteps = 4_000_000
+
+// matchLines pairs the lines of a with lines of b along a shortest edit
+// script (Myers' diff, in linear space).  It returns, for every line of a, the
+// index of the line of b it is paired with or -1.
+func matchLines(a, b []string) []int {
+	m := &lineMatcher{a: a, b: b, match: make([]int, len(a)), steps: matchSteps}
+	for i := range m.match {
+		m.match[i] = -1
+	}
+	size := 2*(len(a)+len(b)) + 5
+	m.forward, m.backward = make([]int, size), make([]int, size)
+	m.compare(0, len(a), 0, len(b))
+	return m.match
+}
+
+type lineMatcher struct {
+	a, b  []string
+	match []int
+	// how far along a the furthest paths on every diagonal got, searching
+	// from the start and from the end
+	forward, backward []int
+	steps             int // left to take
+}
+
+// compare pairs the lines of a[aLo:aHi] with those of b[bLo:bHi].
+func (m *lineMatcher) compare(aLo, aHi, bLo, bHi int) {
+	// the lines the same at both ends need no searching
+	for aLo < aHi && bLo < bHi && m.a[aLo] == m.b[bLo] {
+		m.match[aLo] = bLo
+		aLo, bLo = aLo+1, bLo+1
+	}
+	for aLo < aHi && bLo < bHi && m.a[aHi-1] == m.b[bHi-1] {
+		aHi, bHi = aHi-1, bHi-1
+		m.match[aHi] = bHi
+	}
+	if aLo == aHi || bLo == bHi {
+		return
+	}
+	x, y, ok := m.split(aLo, aHi, bLo, bHi)
+	if !ok || (x == aLo && y == bLo) || (x == aHi && y == bHi) {
+		// out of steps, or no progress, which a shortest edit script
+		// always makes
+		return
+	}
+	m.compare(aLo, x, bLo, y)
+	m.compare(x, aHi, y, bHi)
+}
+
+// split returns a point a shortest edit script from a[aLo:aHi] to b[bLo:bHi]
+// goes through, about halfway along it: where the furthest paths searched for
+// from the start and from the end meet.  ok is false when it ran out of steps.
+func (m *lineMatcher) split(aLo, aHi, bLo, bHi int) (int, int, bool) {
+	a, b := m.a[aLo:aHi], m.b[bLo:bHi]
+	n, mm := len(a), len(b)
+	// diagonal k of the forward search is diagonal delta-k of the backward one
+	delta := n - mm
+	odd := delta%2 != 0
+	steps := (n + mm + 1) / 2
+	offset := steps + 1
+	vf, vb := m.forward, m.backward
+	vf[offset+1], vb[offset+1] = 0, 0
+	for d := 0; d <= steps; d++ {
+		if m.steps -= 2*d + 2; m.steps < 0 {
+			return aLo, bLo, false
+		}
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && vf[offset+k-1] < vf[offset+k+1]) {
+				x = vf[offset+k+1]
+			} else {
+				x = vf[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < mm && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			vf[offset+k] = x
+			if c := delta - k; odd && c >= -(d-1) && c <= d-1 && x+vb[offset+c] >= n {
+				return aLo + x, bLo + y, true
+			}
+		}
+		for c := -d; c <= d; c += 2 {
+			var u int
+			if c == -d || (c != d && vb[offset+c-1] < vb[offset+c+1]) {
+				u = vb[offset+c+1]
+			} else {
+				u = vb[offset+c-1] + 1
+			}
+			v := u - c
+			for u < n && v < mm && a[n-1-u] == b[mm-1-v] {
+				u, v = u+1, v+1
+			}
+			vb[offset+c] = u
+			if k := delta - c; !odd && k >= -d && k <= d && vf[offset+k]+u >= n {
+				return aLo + n - u, bLo + mm - v, true
+			}
+		}
+	}
+	return aLo, bLo, false
+}
@@ -0,0 +1,102 @@
+package editors
+
+import (
+	"slices"
+
+	"github.com/Radisovik/goedit/piecestable"
+	"github.com/gdamore/tcell/v2"
+)
+
+// PieceTableEditor adapts the byte oriented piecestable.Editor to the line and
+// column based Editor interface.  Every line is stored terminated by a '\n' so
+// an empty document and a document holding a single empty line can be told
+// apart.  Lines are found through the newline counts the piece tree keeps, so
+// finding a line never needs the whole text.
+type PieceTableEditor struct {
+	document
+	text   piecestable.Editor
+	styles [][]tcell.Style // styles for each line, newline excluded
+}
+
+func NewPieceTableEditor() Editor {
+	rtn := &PieceTableEditor{
+		text: piecestable.NewEditor(""),
+	}
+	// undo is handled by the document, the piece table doesn't need to keep
+	// its own history as well
+	rtn.text.SetUndoLimit(0)
+	rtn.document = newDocument(rtn)
+	return rtn
+}
+
+func (p *PieceTableEditor) Length() int {
+	// the text always ends with the newline of the last line, so there is one
+	// line fewer than the piece table counts
+	return int(p.text.LineCount()) - 1
+}
+
+func (p *PieceTableEditor) GetLine(line int) ([]rune, []tcell.Style) {
+	if line < 0 {
+		panic("line index out of range")
+	}
+	if line >= p.Length() {
+		return nil, nil
+	}
+	start, end := p.lineBounds(line)
+	return []rune(p.text.Substring(uint(start), uint(end-start))), clone(p.styles[line])
+}
+
+func (p *PieceTableEditor) replace(start, end Position, segs []StyledLine) ([]StyledLine, []StyledLine) {
+	from := p.offset(start)
+	to := p.offset(end)
+
+	styles := make([][]tcell.Style, len(segs))
+	var text []rune
+	for i, seg := range segs {
+		var runes []rune
+		runes, styles[i] = splitStyled(seg)
+		if i > 0 {
+			text = append(text, '\n')
+		}
+		text = append(text, runes...)
+	}
+	repl, count, removedStyles, insertedStyles := spliceLines(p.styles, start, end, styles)
+	p.styles = slices.Replace(p.styles, start.Line, start.Line+count, repl...)
+	inserted := segs
+	if len(insertedStyles) > len(segs) {
+		// the last line got terminated
+		text = append(text, '\n')
+		inserted = append(clone(segs), nil)
+	}
+
+	removedText := splitRunes([]rune(p.text.Substring(uint(from), uint(to-from))))
+	removed := make([]StyledLine, len(removedText))
+	for i, runes := range removedText {
+		removed[i] = joinStyled(runes, removedStyles[i])
+	}
+
+	p.text.Delete(uint(from), uint(to-from))
+	p.text.Insert(uint(from), string(text))
+	return removed, inserted
+}
+
+func (p *PieceTableEditor) restyle(line int, column int, length int, style tcell.Style) {
+	styles := p.styles[line]
+	for i := max(column, 0); i < min(column+length, len(styles)); i++ {
+		styles[i] = style
+	}
+}
+
+// offset turns a position into a byte offset into the piece table.
+func (p *PieceTableEditor) offset(pos Position) int {
+	if pos.Line >= p.Length() {
+		return int(p.text.Len())
+	}
+	return int(p.text.Offset(uint(pos.Line), uint(pos.Column)))
+}
+
+// lineBounds returns the offsets of the first byte of the line and of its
+// terminating newline.
+func (p *PieceTableEditor) lineBounds(line int) (int, int) {
+	return int(p.text.LineStart(uint(line))), int(p.text.LineStart(uint(line+1))) - 1
+}
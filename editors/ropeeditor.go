@@ -0,0 +1,100 @@
+package editors
+
+import (
+	"sync/atomic"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// RopeEditor keeps its text in an immutable Rope.  Every edit swaps in a new
+// root, so Snapshot is free and undo takes the lines an edit touched from an
+// old root instead of replaying edits.
+type RopeEditor struct {
+	document
+	rope atomic.Pointer[Rope]
+}
+
+func NewRopeEditor() Editor {
+	rtn := &RopeEditor{}
+	rtn.rope.Store(NewRope())
+	rtn.document = newDocument(rtn)
+	return rtn
+}
+
+// Snapshot returns the text as it is now.  The Rope never changes, it can be
+// handed to other goroutines (LSP sync, highlighting, saving) and read there
+// without locks while editing goes on.  It is safe to call from any goroutine.
+func (r *RopeEditor) Snapshot() *Rope {
+	return r.rope.Load()
+}
+
+func (r *RopeEditor) Length() int {
+	return r.Snapshot().Length()
+}
+
+func (r *RopeEditor) GetLine(line int) ([]rune, []tcell.Style) {
+	if line < 0 {
+		panic("line index out of range")
+	}
+	text, styles := r.Snapshot().GetLine(line)
+	return clone(text), clone(styles)
+}
+
+func (r *RopeEditor) replace(start, end Position, segs []StyledLine) ([]StyledLine, []StyledLine) {
+	rope := r.Snapshot()
+
+	// only the lines from start to end take part
+	var lines []StyledLine
+	for l := start.Line; l <= min(end.Line, rope.Length()-1); l++ {
+		lines = append(lines, joinStyled(rope.GetLine(l)))
+	}
+	at := func(p Position) Position { return Position{p.Line - start.Line, p.Column} }
+	repl, count, removed, inserted := spliceLines(lines, at(start), at(end), segs)
+
+	rope = rope.DeleteLines(start.Line, start.Line+count).InsertLines(start.Line, repl)
+	r.rope.Store(rope)
+	return removed, inserted
+}
+
+func (r *RopeEditor) restyle(line int, column int, length int, style tcell.Style) {
+	rope := r.Snapshot()
+	text, styles := rope.GetLine(line)
+	styles = clone(styles)
+	for i := max(column, 0); i < min(column+length, len(styles)); i++ {
+		styles[i] = style
+	}
+	r.rope.Store(rope.setLine(line, text, styles))
+}
+
+func (r *RopeEditor) snapshot() any {
+	return r.Snapshot()
+}
+
+// restore puts back the text of the snapshot s between start and snapEnd in
+// place of the text between start and end.  Only the lines in between come
+// from s, so styles applied to the others since it was taken are kept.
+func (r *RopeEditor) restore(s any, start, end, snapEnd Position) {
+	rope, snap := r.Snapshot(), s.(*Rope)
+	left, rest := rope.Split(start.Line)
+	_, right := rest.Split(min(end.Line+1-start.Line, rest.Length()))
+	_, mid := snap.Split(start.Line)
+	mid, _ = mid.Split(min(snapEnd.Line+1-start.Line, mid.Length()))
+
+	// the first and last lines are shared with text outside of the range
+	if start.Column > 0 {
+		text, styles := mid.GetLine(0)
+		_, kept := rope.GetLine(start.Line)
+		styles = clone(styles)
+		copy(styles, kept[:start.Column])
+		mid = mid.setLine(0, text, styles)
+	}
+	if snapEnd.Line < snap.Length() {
+		last := snapEnd.Line - start.Line
+		text, styles := mid.GetLine(last)
+		_, kept := rope.GetLine(end.Line)
+		styles = clone(styles)
+		copy(styles[snapEnd.Column:], kept[end.Column:])
+		mid = mid.setLine(last, text, styles)
+	}
+	r.rope.Store(left.Concat(mid).Concat(right))
+}
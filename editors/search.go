@@ -0,0 +1,143 @@
+package editors
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// SearchOptions say how the text of a Search is matched.
+type SearchOptions struct {
+	CaseSensitive bool
+	WholeWord     bool // matches have to start and end at word boundaries
+	Regexp        bool // the text is a regular expression rather than literal
+}
+
+// Match is a piece of text a Search found.
+type Match struct {
+	Start Position
+	End   Position
+}
+
+// Search finds a text, or a regular expression, in lines of text.  Matches
+// never span lines and are never empty.
+type Search struct {
+	re        *regexp.Regexp
+	wholeWord bool
+	literal   bool
+}
+
+// NewSearch returns a Search for text, the error is only ever set for a bad
+// regular expression.
+func NewSearch(text string, options SearchOptions) (*Search, error) {
+	if !options.Regexp {
+		text = regexp.QuoteMeta(text)
+	}
+	if !options.CaseSensitive {
+		text = "(?i)" + text
+	}
+	re, err := regexp.Compile(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Search{re: re, wholeWord: options.WholeWord, literal: !options.Regexp}, nil
+}
+
+// Line returns the columns every match in line starts and ends at, in order.
+func (s *Search) Line(line []rune) [][2]int {
+	var rtn [][2]int
+	s.each(line, func(start, end int, _ []int) {
+		rtn = append(rtn, [2]int{start, end})
+	})
+	return rtn
+}
+
+// Replacements returns what replaces each of the matches Line returns for
+// line.  For a regular expression $1, ${name} and the like in replacement are
+// expanded to what the groups of the match matched, otherwise it is taken as it
+// is.
+func (s *Search) Replacements(line []rune, replacement string) []string {
+	text := string(line)
+	var rtn []string
+	s.each(line, func(_, _ int, submatches []int) {
+		if s.literal {
+			rtn = append(rtn, replacement)
+		} else {
+			rtn = append(rtn, string(s.re.ExpandString(nil, replacement, text, submatches)))
+		}
+	})
+	return rtn
+}
+
+// each calls fn with the columns of every match in line, and the byte offsets
+// of its groups.
+func (s *Search) each(line []rune, fn func(start, end int, submatches []int)) {
+	text := string(line)
+	// byte offsets to rune columns, the matches come in order
+	offset, column := 0, 0
+	columnOf := func(b int) int {
+		for offset < b {
+			_, size := utf8.DecodeRuneInString(text[offset:])
+			offset += size
+			column++
+		}
+		return column
+	}
+	for _, m := range s.re.FindAllStringSubmatchIndex(text, -1) {
+		if m[0] == m[1] {
+			continue
+		}
+		start, end := columnOf(m[0]), columnOf(m[1])
+		if s.wholeWord && ((start > 0 && isWordRune(line[start-1])) || (end < len(line) && isWordRune(line[end]))) {
+			continue
+		}
+		fn(start, end, m)
+	}
+}
+
+// All returns the matches on the lines from up to, not including, to.
+func (s *Search) All(e Editor, from, to int) []Match {
+	var rtn []Match
+	for l := max(from, 0); l < min(to, e.Length()); l++ {
+		line, _ := e.GetLine(l)
+		for _, m := range s.Line(line) {
+			rtn = append(rtn, Match{Position{l, m[0]}, Position{l, m[1]}})
+		}
+	}
+	return rtn
+}
+
+// Next returns the first match starting at or after from, or when backward is
+// set the last one starting before it.  The search goes around the end of the
+// text to its start, or the other way round.
+func (s *Search) Next(e Editor, from Position, backward bool) (Match, bool) {
+	n := e.Length()
+	if n == 0 {
+		return Match{}, false
+	}
+	if from.Line >= n {
+		last, _ := e.GetLine(n - 1)
+		from = Position{n - 1, len(last)}
+	}
+	// the line of from is looked at twice, first the part on the side the
+	// search goes to and, after going around, the other part
+	for i := 0; i <= n; i++ {
+		l := (from.Line + i) % n
+		if backward {
+			l = (from.Line - i%n + n) % n
+		}
+		line, _ := e.GetLine(l)
+		matches := s.Line(line)
+		for j := range matches {
+			m := matches[j]
+			if backward {
+				m = matches[len(matches)-1-j]
+			}
+			after := m[0] >= from.Column
+			if i == 0 && after == backward || i == n && after != backward {
+				continue
+			}
+			return Match{Position{l, m[0]}, Position{l, m[1]}}, true
+		}
+	}
+	return Match{}, false
+}
@@ -0,0 +1,106 @@
+package editors
+
+// Position identifies a place in a document by line and (rune) column.
+// The position one past the last line, column 0, is the end of the document.
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Before reports whether p comes before q.
+func (p Position) Before(q Position) bool {
+	return p.Line < q.Line || (p.Line == q.Line && p.Column < q.Column)
+}
+
+// spliceLines replaces the text between start and end with segs, the inserted
+// text already split at its newlines (so "a\nb" is two segments and "" is one
+// empty segment).  Every line is considered to be terminated by a newline, so
+// a replacement running to the end of the document never leaves a dangling,
+// unterminated line behind.
+//
+// It returns the lines that take the place of lines start.Line onwards, how many
+// of the old lines they replace, and the removed and inserted text (again as
+// segments), so the caller can invert the operation.
+func spliceLines[L ~[]T, T any](lines []L, start, end Position, segs []L) (repl []L, count int, removed, inserted []L) {
+	var head, tail L
+	if start.Line < len(lines) {
+		head = lines[start.Line][:start.Column]
+	}
+	eof := end.Line >= len(lines)
+	if eof {
+		count = len(lines) - start.Line
+	} else {
+		tail = lines[end.Line][end.Column:]
+		count = end.Line - start.Line + 1
+	}
+
+	// what goes away
+	if start.Line == end.Line && !eof {
+		removed = []L{clone(lines[start.Line][start.Column:end.Column])}
+	} else {
+		if start.Line < len(lines) {
+			removed = append(removed, clone(lines[start.Line][start.Column:]))
+		}
+		for l := start.Line + 1; l < min(end.Line, len(lines)); l++ {
+			removed = append(removed, clone(lines[l]))
+		}
+		if eof {
+			removed = append(removed, nil)
+		} else {
+			removed = append(removed, clone(lines[end.Line][:end.Column]))
+		}
+	}
+
+	// what takes its place
+	inserted = segs
+	repl = make([]L, 0, len(segs))
+	for i, seg := range segs {
+		var line L
+		if i == 0 {
+			line = append(line, head...)
+		}
+		line = append(line, seg...)
+		if i == len(segs)-1 {
+			line = append(line, tail...)
+		}
+		repl = append(repl, line)
+	}
+	if eof {
+		if len(repl[len(repl)-1]) == 0 {
+			// the text ended with a newline already
+			repl = repl[:len(repl)-1]
+		} else {
+			// terminate the last line
+			inserted = append(clone(segs), nil)
+		}
+	}
+	return repl, count, removed, inserted
+}
+
+// endOf returns where text made of segs ends when it is inserted at start.
+func endOf[L ~[]T, T any](start Position, segs []L) Position {
+	if len(segs) == 1 {
+		return Position{start.Line, start.Column + len(segs[0])}
+	}
+	return Position{start.Line + len(segs) - 1, len(segs[len(segs)-1])}
+}
+
+// splitRunes splits text at its newlines.
+func splitRunes(text []rune) [][]rune {
+	segs := [][]rune{nil}
+	for _, r := range text {
+		if r == '\n' {
+			segs = append(segs, nil)
+		} else {
+			segs[len(segs)-1] = append(segs[len(segs)-1], r)
+		}
+	}
+	return segs
+}
+
+func clone[S ~[]T, T any](s S) S {
+	if s == nil {
+		return nil
+	}
+	return append(make(S, 0, len(s)), s...)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/Radisovik/goedit/editors"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// fileEncoding is the character encoding of a file on disk, the editors always
+// hold runes.
+type fileEncoding int
+
+const (
+	UTF8 fileEncoding = iota
+	UTF16LE
+	UTF16BE
+	LATIN1
+	WINDOWS1252
+)
+
+var fileEncodings = []fileEncoding{UTF8, UTF16LE, UTF16BE, LATIN1, WINDOWS1252}
+
+func (enc fileEncoding) String() string {
+	return [...]string{"UTF-8", "UTF-16LE", "UTF-16BE", "Latin-1", "Windows-1252"}[enc]
+}
+
+// byteOrderMark is what a file in the encoding starts with when it has a byte
+// order mark, nil if the encoding has none.
+func (enc fileEncoding) byteOrderMark() []byte {
+	switch enc {
+	case UTF8:
+		return []byte{0xEF, 0xBB, 0xBF}
+	case UTF16LE:
+		return []byte{0xFF, 0xFE}
+	case UTF16BE:
+		return []byte{0xFE, 0xFF}
+	}
+	return nil
+}
+
+// codec converts between the encoding and UTF-8, nil for UTF-8 itself.  Byte
+// order marks are dealt with separately.
+func (enc fileEncoding) codec() encoding.Encoding {
+	switch enc {
+	case UTF16LE:
+		return unicode.UTF16(unicode.LittleEndian, unicode.IgnoreBOM)
+	case UTF16BE:
+		return unicode.UTF16(unicode.BigEndian, unicode.IgnoreBOM)
+	case LATIN1:
+		return charmap.ISO8859_1
+	case WINDOWS1252:
+		return charmap.Windows1252
+	}
+	return nil
+}
+
+// detectEncoding guesses the encoding of content: a byte order mark settles
+// it, otherwise it is UTF-8 when it is valid UTF-8 and Windows-1252, or
+// Latin-1 when it holds bytes Windows-1252 doesn't use, when it isn't.
+func detectEncoding(content []byte) fileEncoding {
+	for _, enc := range []fileEncoding{UTF8, UTF16LE, UTF16BE} {
+		if bytes.HasPrefix(content, enc.byteOrderMark()) {
+			return enc
+		}
+	}
+	if utf8.Valid(content) {
+		return UTF8
+	}
+	for _, b := range content {
+		switch b {
+		case 0x81, 0x8D, 0x8F, 0x90, 0x9D:
+			return LATIN1
+		}
+	}
+	return WINDOWS1252
+}
+
+// decodeText strips the byte order mark off content, if it has one, and
+// converts the rest to UTF-8.  Content that isn't valid in the encoding is an
+// error, the replacement characters it would turn into couldn't be written
+// back as they were.
+func decodeText(content []byte, enc fileEncoding) (text string, bom bool, err error) {
+	if mark := enc.byteOrderMark(); mark != nil && bytes.HasPrefix(content, mark) {
+		content, bom = content[len(mark):], true
+	}
+	if codec := enc.codec(); codec != nil {
+		if enc == UTF16LE || enc == UTF16BE {
+			if err := checkUTF16(content, enc); err != nil {
+				return "", bom, err
+			}
+		}
+		if content, err = codec.NewDecoder().Bytes(content); err != nil {
+			return "", bom, err
+		}
+	} else if !utf8.Valid(content) {
+		return "", bom, fmt.Errorf("not valid %s", enc)
+	}
+	return string(content), bom, nil
+}
+
+// checkUTF16 returns an error for content that isn't valid UTF-16: an odd
+// number of bytes or a surrogate without its other half, which the decoder
+// would quietly turn into replacement characters.
+func checkUTF16(content []byte, enc fileEncoding) error {
+	if len(content)%2 != 0 {
+		return fmt.Errorf("odd number of bytes in %s", enc)
+	}
+	unit := func(i int) uint16 {
+		if enc == UTF16LE {
+			return uint16(content[i]) | uint16(content[i+1])<<8
+		}
+		return uint16(content[i])<<8 | uint16(content[i+1])
+	}
+	for i := 0; i < len(content); i += 2 {
+		switch u := unit(i); {
+		case u >= 0xD800 && u < 0xDC00:
+			if i+2 >= len(content) || unit(i+2) < 0xDC00 || unit(i+2) >= 0xE000 {
+				return fmt.Errorf("unpaired surrogate, not valid %s", enc)
+			}
+			i += 2
+		case u >= 0xDC00 && u < 0xE000:
+			return fmt.Errorf("unpaired surrogate, not valid %s", enc)
+		}
+	}
+	return nil
+}
+
+// encodeText converts a line to the encoding.  A character the encoding can't
+// represent is an error saying where it is.
+func encodeText(text string, enc fileEncoding, line int) ([]byte, error) {
+	codec := enc.codec()
+	if codec == nil {
+		return []byte(text), nil
+	}
+	encoded, err := codec.NewEncoder().Bytes([]byte(text))
+	if err == nil {
+		return encoded, nil
+	}
+	encoder := codec.NewEncoder()
+	column := 0
+	for _, r := range text {
+		if _, err := encoder.String(string(r)); err != nil {
+			return nil, fmt.Errorf("%q at %d:%d can't be written in %s", r, line+1, column+1, enc)
+		}
+		column++
+	}
+	return nil, err
+}
+
+// checkEncoding returns an error for the first character of an editor the
+// encoding can't represent.
+func checkEncoding(f editors.Editor, enc fileEncoding) error {
+	for l := 0; l < f.Length(); l++ {
+		runes, _ := f.GetLine(l)
+		if _, err := encodeText(string(runes), enc, l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		want    fileEncoding
+	}{
+		{"", UTF8},
+		{"plain ascii\n", UTF8},
+		{"café\n", UTF8},
+		{"\xef\xbb\xbfa\n", UTF8},
+		{"\xff\xfea\x00\n\x00", UTF16LE},
+		{"\xfe\xff\x00a\x00\n", UTF16BE},
+		// not UTF-8: smart quotes are Windows-1252
+		{"\x93quoted\x94 caf\xe9\n", WINDOWS1252},
+		// bytes Windows-1252 leaves undefined make it Latin-1
+		{"caf\xe9 \x81\n", LATIN1},
+		{"\x8d\x8f\x90\x9d", LATIN1},
+	} {
+		assert.Equal(t, test.want, detectEncoding([]byte(test.content)), "%q", test.content)
+	}
+}
+
+func TestEncodingRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		enc     fileEncoding
+		lines   []string
+	}{
+		{"café €\n", UTF8, []string{"café €"}},
+		{"\xff\xfec\x00a\x00f\x00\xe9\x00\r\x00\n\x00", UTF16LE, []string{"café"}},
+		{"\xfe\xff\x00c\x00a\x00f\x00\xe9\x00\n", UTF16BE, []string{"café"}},
+		// a pair of surrogates is one character
+		{"\xff\xfe\x3d\xd8\x00\xde\n\x00", UTF16LE, []string{"\U0001f600"}},
+		{"\xff\xfe\xfd\xff\n\x00", UTF16LE, []string{"�"}},
+		{"caf\xe9 \x81\n", LATIN1, []string{"café \u0081"}},
+		{"\x93caf\xe9\x94 \x80\n", WINDOWS1252, []string{"“café” €"}},
+	} {
+		t.Run(test.enc.String(), func(t *testing.T) {
+			lines, format, err := decodeFile([]byte(test.content))
+			assert.NoError(t, err)
+			assert.Equal(t, test.enc, format.encoding)
+			assert.Equal(t, test.lines, lines)
+
+			content, err := encodeFile(newTestEditor(lines), format)
+			assert.NoError(t, err)
+			assert.Equal(t, test.content, string(content))
+		})
+	}
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	for _, test := range []struct {
+		content string
+		enc     fileEncoding
+	}{
+		{"caf\xe9\n", UTF8},
+		{"\xff\xfea\x00\n", UTF16LE},
+		// surrogates without their other half
+		{"\xff\xfe\x00\xd8a\x00", UTF16LE},
+		{"\xff\xfe\x00\xdca\x00", UTF16LE},
+		{"\xfe\xff\xd8\x00", UTF16BE},
+	} {
+		_, _, err := decodeFileAs([]byte(test.content), test.enc)
+		assert.Error(t, err, "%q", test.content)
+	}
+
+	// which loads as Latin-1, so the bytes are kept
+	_, format, err := decodeFile([]byte("\xff\xfe\x00\xd8a\x00"))
+	assert.Error(t, err)
+	assert.Equal(t, LATIN1, format.encoding)
+}
+
+func TestEncodeUnrepresentable(t *testing.T) {
+	_, err := encodeFile(newTestEditor([]string{"ok", "price: €"}), fileFormat{encoding: LATIN1, finalNewline: true})
+	assert.EqualError(t, err, "'€' at 2:8 can't be written in Latin-1")
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+// fileChanged is posted to the key loop when a loaded file changed on disk.
+type fileChanged string
+
+// changedFiles are the files that changed on disk and haven't been looked at
+// yet.
+var changedFiles []string
+
+// checkChangedFiles looks at the files that changed on disk, unless a panel
+// is open.  A file without unsaved changes is loaded again, for one with
+// unsaved changes it asks what to do.
+func checkChangedFiles() {
+	for activePanel == nil && len(changedFiles) > 0 {
+		filePath := changedFiles[0]
+		changedFiles = changedFiles[1:]
+		info := fileInfos[filePath]
+		content, err := os.ReadFile(filePath)
+		if os.IsNotExist(err) {
+			setStatus("%s was deleted on disk", filePath)
+			continue
+		} else if err != nil {
+			statusError(err)
+			continue
+		}
+		// goedit's own saves and changes already seen
+		if sha256.Sum256(content) == info.disk {
+			continue
+		}
+		lines, format, err := decodeFile(content)
+		if err != nil {
+			logf("%s is loaded as %s: %v", filePath, format.encoding, err)
+		}
+		if !isModified(filePath) {
+			setText(filePath, content, lines, format)
+			setStatus("Reloaded %s, it changed on disk", filePath)
+			continue
+		}
+		activePanel = &changedPanel{filePath, content, lines, format}
+	}
+}
+
+// changedPanel asks what to do about a file with unsaved changes that changed
+// on disk: load it again, throwing the changes away, keep the changes and
+// overwrite the file when saving, or merge the changes made on disk since the
+// file was loaded into the buffer.
+type changedPanel struct {
+	filePath string
+	content  []byte
+	lines    []string
+	format   fileFormat
+}
+
+func (p *changedPanel) draw() {
+	drawList(fmt.Sprintf("%s changed on disk: R)eload  K)eep mine  M)erge", p.filePath), []string{
+		"The file has unsaved changes.",
+		"Reload throws them away, undo brings them back.",
+		"Merge puts the changes made on disk into the buffer, marking conflicts.",
+	}, -1)
+}
+
+func (p *changedPanel) handleKey(ev *tcell.EventKey) bool {
+	info := fileInfos[p.filePath]
+	switch ev.Rune() {
+	case 'r', 'R':
+		setText(p.filePath, p.content, p.lines, p.format)
+		setStatus("Reloaded %s", p.filePath)
+	case 'k', 'K':
+		// don't ask again for this content
+		info.disk = sha256.Sum256(p.content)
+	case 'm', 'M':
+		merged, conflicts := editors.Merge3(info.base, editorLines(files[p.filePath]), p.lines, "buffer", "disk")
+		replaceText(p.filePath, merged)
+		info.disk = sha256.Sum256(p.content)
+		info.base = p.lines
+		info.saved = p.format
+		if conflicts > 0 {
+			statusError(fmt.Errorf("merging %s: %d conflicts, look for <<<<<<<", p.filePath, conflicts))
+		} else {
+			setStatus("Merged the changes to %s on disk", p.filePath)
+		}
+	default:
+		return true
+	}
+	return false
+}
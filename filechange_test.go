@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// changeOnDisk writes a loaded file behind goedit's back and lets it look at
+// the change.
+func changeOnDisk(t *testing.T, filePath, content string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	changedFiles = append(changedFiles, filePath)
+	t.Cleanup(func() { activePanel, changedFiles = nil, nil })
+	checkChangedFiles()
+}
+
+// answerChanged presses a key in the panel asking about a changed file.
+func answerChanged(t *testing.T, key rune) {
+	t.Helper()
+	if assert.IsType(t, &changedPanel{}, activePanel) {
+		assert.False(t, activePanel.handleKey(tcell.NewEventKey(tcell.KeyRune, key, tcell.ModNone)))
+		activePanel = nil
+	}
+}
+
+func TestReloadChangedFile(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two")
+	changeOnDisk(t, filePath, "one\nthree\n")
+	assert.Nil(t, activePanel)
+	assert.Equal(t, []string{"one", "three"}, editorLines(f))
+	assert.False(t, isModified(filePath))
+	assert.Equal(t, "Reloaded "+filePath+", it changed on disk", statusMessage)
+
+	// reloading is an edit that can be undone
+	f.Undo()
+	assert.Equal(t, []string{"one", "two"}, editorLines(f))
+
+	// nor is the file loaded again for what goedit saved itself
+	f.InsertText(0, 0, "saved ", CODE_DEFAULT_STYLE)
+	assert.NoError(t, saveFile(filePath))
+	changedFiles = append(changedFiles, filePath)
+	checkChangedFiles()
+	assert.Equal(t, []string{"saved one", "two"}, editorLines(f))
+	assert.False(t, isModified(filePath))
+}
+
+func TestMergeChangedFile(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two", "three", "four")
+	f.InsertText(0, 3, " mine", CODE_DEFAULT_STYLE)
+	changeOnDisk(t, filePath, "one\ntwo\nthree\nfour theirs\n")
+	answerChanged(t, 'm')
+	assert.Equal(t, []string{"one mine", "two", "three", "four theirs"}, editorLines(f))
+	assert.Equal(t, "Merged the changes to "+filePath+" on disk", statusMessage)
+	assert.Equal(t, []string{"one", "two", "three", "four theirs"}, fileInfos[filePath].base)
+	assertFile(t, filePath, "one\ntwo\nthree\nfour theirs\n")
+
+	// a second change is merged against the first
+	changeOnDisk(t, filePath, "one\ntwo\nthree again\nfour theirs\n")
+	answerChanged(t, 'm')
+	assert.Equal(t, []string{"one mine", "two", "three again", "four theirs"}, editorLines(f))
+}
+
+func TestMergeChangedFileConflict(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two")
+	f.InsertText(1, 3, " mine", CODE_DEFAULT_STYLE)
+	changeOnDisk(t, filePath, "one\ntwo theirs\n")
+	answerChanged(t, 'm')
+	assert.Equal(t, []string{"one", "<<<<<<< buffer", "two mine", "=======", "two theirs", ">>>>>>> disk"}, editorLines(f))
+	assert.True(t, statusIsError)
+	assert.Equal(t, "Error merging "+filePath+": 1 conflicts, look for <<<<<<<", statusMessage)
+	assert.True(t, isModified(filePath))
+}
+
+func TestReloadOrKeepChangedFile(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	f.InsertText(0, 0, "mine ", CODE_DEFAULT_STYLE)
+
+	// keeping the buffer doesn't ask again for the same content
+	changeOnDisk(t, filePath, "theirs\n")
+	answerChanged(t, 'k')
+	assert.Equal(t, []string{"mine one"}, editorLines(f))
+	changeOnDisk(t, filePath, "theirs\n")
+	assert.Nil(t, activePanel)
+
+	// reloading throws the changes away, undo brings them back
+	changeOnDisk(t, filePath, "theirs again\n")
+	answerChanged(t, 'r')
+	assert.Equal(t, []string{"theirs again"}, editorLines(f))
+	assert.False(t, isModified(filePath))
+	f.Undo()
+	assert.Equal(t, []string{"mine one"}, editorLines(f))
+}
+
+func TestChangedFileDeleted(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	f.InsertText(0, 0, "mine ", CODE_DEFAULT_STYLE)
+	assert.NoError(t, os.Remove(filePath))
+	changedFiles = append(changedFiles, filePath)
+	checkChangedFiles()
+	assert.Nil(t, activePanel)
+	assert.Equal(t, filePath+" was deleted on disk", statusMessage)
+	assert.Equal(t, []string{"mine one"}, editorLines(f))
+	assert.True(t, isModified(filePath))
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Radisovik/goedit/editors"
+)
+
+// lineEnding is how the lines of a file end on disk.
+type lineEnding int
+
+const (
+	LF lineEnding = iota
+	CRLF
+	// MIXED files have lines ending either way.  Their lines are loaded with
+	// the '\r' of a "\r\n" kept at their end and are written back with "\n",
+	// so they go back to disk exactly as they were.
+	MIXED
+)
+
+func (le lineEnding) String() string {
+	return [...]string{"LF", "CRLF", "Mixed"}[le]
+}
+
+// fileFormat is how the text of a file is laid out on disk, apart from the
+// text itself.
+type fileFormat struct {
+	encoding     fileEncoding
+	lineEnding   lineEnding
+	bom          bool // starts with the byte order mark of its encoding
+	finalNewline bool // the last line ends in a newline
+}
+
+// fileInfo is what is known about a loaded file besides its text: its format,
+// so saving writes it back the same way, and the format it has on disk.  The
+// hash of the content of the file on disk, and the lines it had, tell changes
+// made to it by others from the ones goedit made and are the base for merging
+// them.
+type fileInfo struct {
+	format    fileFormat
+	saved     fileFormat
+	disk      [sha256.Size]byte
+	base      []string
+	savedHash string // linesHash of the text the editor was last marked saved with
+	inPlace   bool   // saved last by writing over it, it couldn't be replaced
+}
+
+func newFileInfo(content []byte, lines []string, format fileFormat) *fileInfo {
+	return &fileInfo{format: format, saved: format, disk: sha256.Sum256(content), base: lines, savedHash: linesHash(lines)}
+}
+
+var fileInfos = make(map[string]*fileInfo)
+
+// decodeFile splits the content of a file into its lines and works out its
+// format.  Content that can't be decoded in the encoding it seems to be in is
+// loaded as Latin-1, which takes any bytes, and the error says why.
+func decodeFile(content []byte) ([]string, fileFormat, error) {
+	lines, format, err := decodeFileAs(content, detectEncoding(content))
+	if err != nil {
+		lines, format, _ = decodeFileAs(content, LATIN1)
+	}
+	return lines, format, err
+}
+
+// decodeFileAs is decodeFile for content in a given encoding.
+func decodeFileAs(content []byte, enc fileEncoding) ([]string, fileFormat, error) {
+	format := fileFormat{encoding: enc, finalNewline: true}
+	text, bom, err := decodeText(content, enc)
+	if err != nil {
+		return nil, format, err
+	}
+	format.bom = bom
+	if len(text) == 0 {
+		return nil, format, nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	} else {
+		format.finalNewline = false
+	}
+
+	crlf, lf := 0, 0
+	for i, line := range lines {
+		if i == len(lines)-1 && !format.finalNewline {
+			break
+		}
+		if strings.HasSuffix(line, "\r") {
+			crlf++
+		} else {
+			lf++
+		}
+	}
+	switch {
+	case crlf > 0 && lf > 0:
+		format.lineEnding = MIXED
+	case crlf > 0:
+		format.lineEnding = CRLF
+		for i, line := range lines {
+			if i < len(lines)-1 || format.finalNewline {
+				lines[i] = strings.TrimSuffix(line, "\r")
+			}
+		}
+	}
+	return lines, format, nil
+}
+
+// encodeFile is the text of an editor as it goes on disk in the given format.
+// It fails when the text holds a character the encoding can't represent.
+func encodeFile(f editors.Editor, format fileFormat) ([]byte, error) {
+	eol := "\n"
+	if format.lineEnding == CRLF {
+		eol = "\r\n"
+	}
+	var buf bytes.Buffer
+	if format.bom {
+		buf.Write(format.encoding.byteOrderMark())
+	}
+	for l := 0; l < f.Length(); l++ {
+		runes, _ := f.GetLine(l)
+		text := string(runes)
+		if l < f.Length()-1 || format.finalNewline {
+			text += eol
+		}
+		encoded, err := encodeText(text, format.encoding, l)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encoded)
+	}
+	return buf.Bytes(), nil
+}
+
+// describe is the format as the status line shows it.
+func (format fileFormat) describe() string {
+	parts := []string{format.encoding.String(), format.lineEnding.String()}
+	if format.bom {
+		parts = append(parts, "BOM")
+	}
+	if !format.finalNewline {
+		parts = append(parts, "no final newline")
+	}
+	return strings.Join(parts, " ")
+}
+
+// setLineEnding makes the lines of a file end in "\n" or "\r\n" when it is
+// saved.  Converting a file with mixed line endings drops the '\r' its lines
+// were loaded with, which is an edit of its own.
+func setLineEnding(filePath string, le lineEnding) {
+	info := fileInfos[filePath]
+	if info.format.lineEnding == MIXED {
+		f := files[filePath]
+		endTyping()
+		f.BeginTransaction(editors.Position{Line: cy, Column: cx})
+		for l := 0; l < f.Length(); l++ {
+			line, _ := f.GetLine(l)
+			if n := len(line); n > 0 && line[n-1] == '\r' {
+				f.DeleteRange(editors.Position{Line: l, Column: n - 1}, editors.Position{Line: l, Column: n})
+			}
+		}
+		f.EndTransaction(editors.Position{Line: cy, Column: cx})
+	}
+	info.format.lineEnding = le
+	setStatus("Format of %s: %s", filePath, info.format.describe())
+}
+
+// toggleBOM adds the byte order mark when saving a file, or stops adding it.
+func toggleBOM(filePath string) {
+	info := fileInfos[filePath]
+	if info.format.encoding.byteOrderMark() == nil {
+		setStatus("%s has no byte order mark", info.format.encoding)
+		return
+	}
+	info.format.bom = !info.format.bom
+	setStatus("Format of %s: %s", filePath, info.format.describe())
+}
+
+// toggleFinalNewline ends the last line of a file with a newline when saving
+// it, or stops doing so.
+func toggleFinalNewline(filePath string) {
+	info := fileInfos[filePath]
+	info.format.finalNewline = !info.format.finalNewline
+	setStatus("Format of %s: %s", filePath, info.format.describe())
+}
+
+// formatCommands are the tools changing the format of the file shown.
+func formatCommands() []tool {
+	inFile := func(fn func(string)) func() {
+		return func() {
+			if currentFile == "" {
+				setStatus("No file shown")
+				return
+			}
+			fn(currentFile)
+		}
+	}
+	tools := []tool{
+		{"Line endings: LF", inFile(func(path string) { setLineEnding(path, LF) })},
+		{"Line endings: CRLF", inFile(func(path string) { setLineEnding(path, CRLF) })},
+		{"Byte order mark: add/remove", inFile(toggleBOM)},
+		{"Final newline: add/remove", inFile(toggleFinalNewline)},
+	}
+	for _, enc := range fileEncodings {
+		tools = append(tools, tool{"Save as " + enc.String(), inFile(func(path string) { setEncoding(path, enc) })})
+	}
+	for _, enc := range fileEncodings {
+		tools = append(tools, tool{"Reopen as " + enc.String(), inFile(func(path string) { reopenFile(path, enc) })})
+	}
+	return tools
+}
+
+// setEncoding makes a file be saved in another encoding, warning straight
+// away about characters that can't be written in it.
+func setEncoding(filePath string, enc fileEncoding) {
+	info := fileInfos[filePath]
+	info.format.encoding = enc
+	// UTF-16 files are expected to start with a byte order mark
+	info.format.bom = enc == UTF16LE || enc == UTF16BE
+	if err := checkEncoding(files[filePath], enc); err != nil {
+		statusError(fmt.Errorf("%w, %s can't be saved until it is changed", err, filePath))
+		return
+	}
+	setStatus("Format of %s: %s", filePath, info.format.describe())
+}
+
+// reopenFile loads a file again, decoding it in the given encoding for when
+// it was taken for another one.
+func reopenFile(filePath string, enc fileEncoding) {
+	if isModified(filePath) {
+		setStatus("%s has unsaved changes, save or undo them first", filePath)
+		return
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		statusError(err)
+		return
+	}
+	lines, format, err := decodeFileAs(content, enc)
+	if err != nil {
+		statusError(fmt.Errorf("%s as %s: %w", filePath, enc, err))
+		return
+	}
+	setText(filePath, content, lines, format)
+	setStatus("Format of %s: %s", filePath, format.describe())
+}
+
+// setText replaces the text of a loaded file with what was read from disk, as
+// an edit that can be undone, and marks it saved.
+func setText(filePath string, content []byte, lines []string, format fileFormat) {
+	replaceText(filePath, lines)
+	files[filePath].MarkSaved()
+	fileInfos[filePath] = newFileInfo(content, lines, format)
+	resetJournal(filePath)
+}
+
+// replaceText replaces the lines of a loaded file, as an edit that can be
+// undone.  The cursors of the file stay where they were, as far as the new
+// text reaches.
+func replaceText(filePath string, lines []string) {
+	f := files[filePath]
+	if filePath == currentFile {
+		endTyping()
+	}
+	var selections []editors.Selection
+	c := fileCursors[filePath]
+	if c != nil {
+		primary := c.Primary()
+		selections = append(slices.DeleteFunc(c.Selections(), func(sel editors.Selection) bool { return sel == primary }), primary)
+	}
+	text := ""
+	if len(lines) > 0 {
+		text = strings.Join(lines, "\n") + "\n"
+	}
+	f.ReplaceRange(editors.Position{}, editors.Position{Line: f.Length()}, text, CODE_DEFAULT_STYLE)
+	if c != nil {
+		for i, sel := range selections {
+			selections[i] = editors.Selection{Head: clampPosition(f, sel.Head), Tail: clampPosition(f, sel.Tail)}
+		}
+		c.Set(selections)
+	}
+	if filePath == currentFile {
+		syncCursor()
+	}
+}
+
+// clampPosition returns the position in the text of f nearest to pos.
+func clampPosition(f editors.Editor, pos editors.Position) editors.Position {
+	if f.Length() == 0 {
+		return editors.Position{}
+	}
+	pos.Line = max(0, min(pos.Line, f.Length()-1))
+	pos.Column = max(0, min(pos.Column, lineLength(f, pos.Line)))
+	return pos
+}
+
+// editorLines returns the lines of an editor.
+func editorLines(f editors.Editor) []string {
+	lines := make([]string, f.Length())
+	for l := range lines {
+		runes, _ := f.GetLine(l)
+		lines[l] = string(runes)
+	}
+	return lines
+}
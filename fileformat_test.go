@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceTextKeepsCursors(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two", "three")
+	c := newCursors(f)
+	fileCursors[filePath] = c
+	t.Cleanup(func() { delete(fileCursors, filePath) })
+	c.Set([]editors.Selection{
+		{Head: editors.Position{Line: 2, Column: 4}, Tail: editors.Position{Line: 2, Column: 4}},
+		{Head: editors.Position{Line: 0, Column: 1}, Tail: editors.Position{Line: 0, Column: 1}},
+	})
+
+	replaceText(filePath, []string{"ONE", "2"})
+	assert.Equal(t, []editors.Selection{
+		{Head: editors.Position{Line: 0, Column: 1}, Tail: editors.Position{Line: 0, Column: 1}},
+		{Head: editors.Position{Line: 1, Column: 1}, Tail: editors.Position{Line: 1, Column: 1}},
+	}, c.Selections())
+	assert.Equal(t, editors.Position{Line: 0, Column: 1}, c.Primary().Head)
+
+	// typing doesn't replace the whole text
+	c.Insert("x", tcell.StyleDefault)
+	assert.Equal(t, []string{"OxNE", "2x"}, editorLines(f))
+}
+
+// newTestEditor returns an editor holding lines.
+func newTestEditor(lines []string) editors.Editor {
+	f := NewEditor()
+	for n, line := range lines {
+		f.InsertLine(n, line)
+	}
+	return f
+}
+
+func TestFileFormatRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		lines   []string
+		format  fileFormat
+	}{
+		{"LF", "a\nb\n", []string{"a", "b"}, fileFormat{lineEnding: LF, finalNewline: true}},
+		{"CRLF", "a\r\nb\r\n", []string{"a", "b"}, fileFormat{lineEnding: CRLF, finalNewline: true}},
+		{"mixed", "a\r\nb\nc\r\n", []string{"a\r", "b", "c\r"}, fileFormat{lineEnding: MIXED, finalNewline: true}},
+		{"BOM", "\xef\xbb\xbfa\n", []string{"a"}, fileFormat{lineEnding: LF, bom: true, finalNewline: true}},
+		{"no final newline", "a\nb", []string{"a", "b"}, fileFormat{lineEnding: LF}},
+		{"CRLF no final newline", "a\r\nb", []string{"a", "b"}, fileFormat{lineEnding: CRLF}},
+		{"CR at the end", "a\r\nb\r", []string{"a", "b\r"}, fileFormat{lineEnding: CRLF}},
+		{"empty", "", nil, fileFormat{lineEnding: LF, finalNewline: true}},
+		{"empty line", "\n", []string{""}, fileFormat{lineEnding: LF, finalNewline: true}},
+		{"empty CRLF line", "\r\n", []string{""}, fileFormat{lineEnding: CRLF, finalNewline: true}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			lines, format, err := decodeFileAs([]byte(test.content), UTF8)
+			assert.NoError(t, err)
+			assert.Equal(t, test.lines, lines)
+			assert.Equal(t, test.format, format)
+
+			content, err := encodeFile(newTestEditor(lines), format)
+			assert.NoError(t, err)
+			assert.Equal(t, test.content, string(content))
+		})
+	}
+}
@@ -12,10 +12,13 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
+	"unicode"
+	"unicode/utf16"
 )
 
 var logfile *os.File
@@ -26,6 +29,13 @@ const MENU_LINE = 0
 const FILE_TABS_LINE = 1
 const EDITOR_LINE = 2
 
+// TEXT_COLUMN is the screen column the text of the editor area starts at, after
+// the line numbers.
+const TEXT_COLUMN = 6
+
+// TAB_WIDTH is the number of screen cells between tab stops.
+const TAB_WIDTH = 4
+
 const ColorFaintGrey = tcell.ColorIsRGB | tcell.ColorValid | 0x323232
 
 var LINE_NUMBERS_STYLE = tcell.Style{}.Foreground(tcell.ColorDarkGray)
@@ -34,6 +44,7 @@ var LOG_DEFAULT_STYLE = tcell.Style{}.Foreground(tcell.ColorLightSteelBlue).Back
 var MENU_ENABLED_STYLE = tcell.Style{}.Foreground(tcell.ColorWhite).Background(ColorFaintGrey)
 var MENU_DISABLED_STYLE = tcell.Style{}.Foreground(tcell.ColorDarkGray).Background(tcell.ColorBlack)
 var FILE_TAB_STYLE = tcell.Style{}.Foreground(tcell.ColorYellow).Background(tcell.ColorBlack)
+var SELECTION_STYLE = tcell.Style{}.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkBlue)
 var currentFile = ""
 var menuState = "disabled"
 
@@ -57,6 +68,12 @@ var logLines = [NUM_LOG_LINES]string{}
 var files = make(map[string]editors.Editor)
 
 func logf(format string, args ...interface{}) {
+	showLog(writeLog(format, args...))
+}
+
+// writeLog adds a line to goedit.log and returns it, unlike drawing it this
+// can be done from any goroutine.
+func writeLog(format string, args ...interface{}) string {
 	logOpen.Do(func() {
 		var err error
 		logfile, err = os.OpenFile("goedit.log", os.O_APPEND|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
@@ -67,17 +84,20 @@ func logf(format string, args ...interface{}) {
 	format = strings.TrimSpace(format)
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	_, err := logfile.WriteString(fmt.Sprintf("%s %s \n", timestamp, fmt.Sprintf(format, args...)))
+	msg := fmt.Sprintf(format, args...)
+	_, err := logfile.WriteString(fmt.Sprintf("%s %s \n", timestamp, msg))
 	if err != nil {
 		panic(err)
 	}
+	return msg
+}
 
+// showLog puts a line at the top of the log area.
+func showLog(msg string) {
 	// Scroll the log lines array and add the new log line at the top
 	for i := len(logLines) - 1; i > 0; i-- {
 		logLines[i] = logLines[i-1]
 	}
-	msg := fmt.Sprintf("%s", fmt.Sprintf(format, args...))
-
 	logLines[0] = msg
 
 	if screen != nil {
@@ -94,9 +114,31 @@ func logf(format string, args ...interface{}) {
 	}
 }
 
+// logMessage is posted to the key loop by goroutines with something to log,
+// the log area is only drawn there.
+type logMessage string
+
+// backgroundLogf is logf for goroutines other than the key loop.  The line is
+// in goedit.log straight away, it is shown once the key loop gets to it.
+func backgroundLogf(format string, args ...interface{}) {
+	msg := writeLog(format, args...)
+	if screen != nil {
+		screen.PostEvent(tcell.NewEventInterrupt(logMessage(msg)))
+	}
+}
+
 var cx = 0
 var cy = 0
 
+// cursors are the cursors of the editor area, cx and cy follow the primary one.
+var cursors *editors.Cursors
+
+// clipboard holds what was cut or copied last, a piece per cursor.
+// clipboardBlock is set when it came from a rectangular selection, it is then
+// pasted as a rectangle too.
+var clipboard []string
+var clipboardBlock = false
+
 var logArea *ViewArea
 var editorArea *ViewArea
 var menuArea *ViewArea
@@ -109,7 +151,12 @@ func render() {
 	}
 	editorArea.render()
 	menuArea.render()
+	drawFileTabs()
 	tabsArea.render()
+	drawStatusLine()
+	if activePanel != nil {
+		activePanel.draw()
+	}
 	screen.Show()
 }
 
@@ -172,6 +219,7 @@ func main() {
 	screen.SetStyle(defStyle)
 
 	screen.SetCursorStyle(tcell.CursorStyleBlinkingBar)
+	screen.EnableMouse()
 
 	//screen.ShowCursor(cx+6, cy+EDITOR_LINE)
 	// Clear screen
@@ -182,6 +230,11 @@ func main() {
 		// re-raise them - otherwise your application can
 		// die without leaving any diagnostic trace.
 		maybePanic := recover()
+		if maybePanic == nil {
+			saveUndoHistories()
+		}
+		// after a crash the journals are what is left of the unsaved edits
+		closeJournals(maybePanic == nil)
 		screen.Fini()
 		if maybePanic != nil {
 			panic(maybePanic)
@@ -193,6 +246,10 @@ func main() {
 	loadFiles()
 	inited := false
 	for {
+		if inited {
+			checkRecoveries()
+			checkChangedFiles()
+		}
 		// update the tcell buffer from our text documents
 		// and tell tcell to redraw
 		render()
@@ -209,46 +266,131 @@ func main() {
 				inited = true
 			}
 			screen.Sync()
+		case *tcell.EventInterrupt:
+			// a background job has something new to show or needs the text of a
+			// file, or a file changed
+			switch data := ev.Data().(type) {
+			case logMessage:
+				showLog(string(data))
+			case fileChanged:
+				changedFiles = append(changedFiles, string(data))
+			case fileTextRequest:
+				data.answer()
+			}
 		case *tcell.EventKey:
-			if menuState == "enabled" {
-				if ev.Rune() == 'Q' || ev.Rune() == 'q' {
+			if activePanel != nil {
+				if !activePanel.handleKey(ev) {
+					activePanel = nil
+				}
+				if quitting {
 					screen.Clear()
 					return
+				}
+				continue
+			}
+			if menuState == "enabled" {
+				if ev.Rune() == 'Q' || ev.Rune() == 'q' {
+					enableMenu(false)
+					requestQuit()
 				} else if ev.Rune() == 'L' || ev.Rune() == 'l' {
 					screen.Sync()
 				} else if ev.Rune() == 'T' || ev.Rune() == 't' {
+					enableMenu(false)
+					openToolsPanel(append([]tool{{"Format with gopls", func() {
+						if err := sendFormattingRequest(stdin, "file://"+currentFile); err != nil {
+							logf("Error sending formatting request: %v", err)
+						}
+					}}}, formatCommands()...))
 
 				} else if ev.Rune() == 'R' || ev.Rune() == 'r' {
 
 				} else if ev.Rune() == 'S' || ev.Rune() == 's' {
+					enableMenu(false)
+					openSearchPanel()
+				} else if ev.Rune() == 'F' || ev.Rune() == 'f' {
+					enableMenu(false)
+					openProjectSearchPanel()
 
+				} else if ev.Rune() == 'H' || ev.Rune() == 'h' {
+					enableMenu(false)
+					openUndoPanel()
 				} else {
 					enableMenu(false)
 				}
 
 			} else {
+				if ev.Key() != tcell.KeyRune || !isWordRune(ev.Rune()) {
+					endTyping()
+				}
+				shift := ev.Modifiers()&tcell.ModShift != 0
+				alt := ev.Modifiers()&tcell.ModAlt != 0
 				if ev.Key() == tcell.KeyEscape {
-					enableMenu(true)
-
+					if len(cursors.Selections()) > 1 || !cursors.Primary().Empty() {
+						cursors.Collapse()
+					} else {
+						enableMenu(true)
+					}
 				} else if ev.Key() == tcell.KeyCtrlC {
-					screen.Clear()
-					return
+					requestQuit()
+				} else if ev.Key() == tcell.KeyDown && alt && shift {
+					cursors.ExtendBlock(1, 0)
+				} else if ev.Key() == tcell.KeyUp && alt && shift {
+					cursors.ExtendBlock(-1, 0)
+				} else if ev.Key() == tcell.KeyLeft && alt && shift {
+					cursors.ExtendBlock(0, -1)
+				} else if ev.Key() == tcell.KeyRight && alt && shift {
+					cursors.ExtendBlock(0, 1)
+				} else if ev.Key() == tcell.KeyDown && alt {
+					cursors.AddBelow()
+				} else if ev.Key() == tcell.KeyUp && alt {
+					cursors.AddAbove()
 				} else if ev.Key() == tcell.KeyDown {
-					moveCursor(0, 1)
+					cursors.Move(1, 0, shift)
 				} else if ev.Key() == tcell.KeyUp {
-					moveCursor(0, -1)
+					cursors.Move(-1, 0, shift)
 				} else if ev.Key() == tcell.KeyLeft {
-					moveCursor(-1, 0)
+					cursors.Move(0, -1, shift)
 				} else if ev.Key() == tcell.KeyRight {
-					moveCursor(1, 0)
+					cursors.Move(0, 1, shift)
 				} else if ev.Key() == tcell.KeyEnter {
-					editorArea.InsertChar(cy, cx, '\n', CODE_DEFAULT_STYLE)
-					setCursor(0, cy+1)
-				} else if ev.Key() == tcell.KeyCtrlS {
-					// Request formatting
-					if err := sendFormattingRequest(stdin, "file://"+currentFile); err != nil {
-						logf("Error sending formatting request: %v", err)
+					cursors.Insert("\n", CODE_DEFAULT_STYLE)
+				} else if ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2 {
+					cursors.Backspace()
+				} else if ev.Key() == tcell.KeyDelete {
+					cursors.Delete()
+				} else if ev.Key() == tcell.KeyCtrlD {
+					// select the word under the cursor, then its next occurrences
+					cursors.AddNextOccurrence()
+				} else if ev.Key() == tcell.KeyCtrlF {
+					openSearchPanel()
+				} else if ev.Key() == tcell.KeyCtrlL {
+					cursors.SplitLines()
+				} else if ev.Key() == tcell.KeyCtrlX {
+					clipboardBlock = cursors.InBlock()
+					clipboard = cursors.Cut()
+				} else if ev.Key() == tcell.KeyCtrlV {
+					if clipboardBlock && len(clipboard) != len(cursors.Selections()) {
+						cursors.PasteBlock(clipboard, CODE_DEFAULT_STYLE)
+					} else {
+						cursors.InsertEach(clipboard, CODE_DEFAULT_STYLE)
+					}
+				} else if ev.Key() == tcell.KeyRune && alt && ev.Rune() == 'c' {
+					clipboardBlock = cursors.InBlock()
+					clipboard = cursors.Texts()
+				} else if ev.Key() == tcell.KeyCtrlZ {
+					if undoReplace() {
+						// a replace in files was undone in all of them
+					} else if pos, ok := editorArea.content.Undo(); ok {
+						setCursor(pos.Column, pos.Line)
+					}
+				} else if ev.Key() == tcell.KeyCtrlY {
+					if redoReplace() {
+						// a replace in files was redone in all of them
+					} else if pos, ok := editorArea.content.Redo(); ok {
+						setCursor(pos.Column, pos.Line)
 					}
+				} else if ev.Key() == tcell.KeyCtrlS {
+					saveCurrentFile()
 				} else {
 					if ev.Rune() == '.' {
 						// Request completion
@@ -263,39 +405,73 @@ func main() {
 
 						}
 					} else {
-						// Insert the new rune at the current cursor position and shift others to the right
-						if ev.Key() == 127 {
-
-						} else {
-							newRune := ev.Rune()
-							if newRune != 0 { // Ensure it's a valid rune
-								moveCursor(1, 0) // Move the cursor to the right after inserting
-								editorArea.InsertChar(cy, cx, newRune, CODE_DEFAULT_STYLE)
-							}
+						// Insert the new rune at every cursor, replacing the selections
+						newRune := ev.Rune()
+						if newRune != 0 { // Ensure it's a valid rune
+							beginTyping()
+							cursors.Insert(string(newRune), CODE_DEFAULT_STYLE)
 						}
-
 					}
 				}
+				syncCursor()
+			}
+			if quitting {
+				screen.Clear()
+				return
 			}
 		case *tcell.EventMouse:
-			//x, y := ev.Position()
-			//
-			//switch ev.Buttons() {
-			//case tcell.Button1, tcell.Button2:
-			//if ox < 0 {
-			//	ox, oy = x, y // record location when click started
-			//}
-
-			//case tcell.ButtonNone:
-			//	if ox >= 0 {
-			//		label := fmt.Sprintf("%d,%d to %d,%d", ox, oy, x, y)
-			//		drawBox(s, ox, oy, x, y, boxStyle, label)
-			//		ox, oy = -1, -1
-			//	}
+			if activePanel != nil || editorArea == nil {
+				continue
+			}
+			x, y := ev.Position()
+			switch ev.Buttons() {
+			case tcell.Button1:
+				line := max(0, min(y-EDITOR_LINE+editorArea.topVisibleLine, editorArea.content.Length()-1))
+				pos := editors.Position{Line: line, Column: max(0, x-TEXT_COLUMN)}
+				if !mouseDown {
+					// the column of a block is visual, of a cursor it is a rune
+					mouseDown, mouseStart = true, pos
+					text, _ := editorArea.content.GetLine(line)
+					setCursor(editors.RuneColumn(text, pos.Column, TAB_WIDTH), line)
+				} else if ev.Modifiers()&tcell.ModAlt != 0 {
+					// dragging with Alt held selects a rectangle
+					cursors.SelectBlock(mouseStart, pos)
+					syncCursor()
+				}
+			case tcell.ButtonNone:
+				mouseDown = false
+			}
 		}
 	}
 }
 
+// mouseDown is set while the first button is held, mouseStart is where it was
+// pressed.
+var mouseDown = false
+var mouseStart editors.Position
+
+// typing is true while the characters of a word are being typed, they are
+// grouped in one transaction so a single undo removes the whole word.
+var typing = false
+
+func beginTyping() {
+	if !typing {
+		editorArea.content.BeginTransaction(editors.Position{Line: cy, Column: cx})
+		typing = true
+	}
+}
+
+func endTyping() {
+	if typing {
+		editorArea.content.EndTransaction(editors.Position{Line: cy, Column: cx})
+		typing = false
+	}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
 func enableMenu(enabled bool) {
 	if !enabled {
 		menuArea.FillStyle(MENU_DISABLED_STYLE)
@@ -326,22 +502,24 @@ func NewWideLineThing(x, y int, s tcell.Style, content string) *ViewArea {
 }
 
 func NewEditor() editors.Editor {
-	return &editors.DirtSimpleEditor{}
+	return editors.NewPieceTableEditor()
 }
 
 func setupAreas() {
 	width, height := screen.Size()
 	editorArea = &ViewArea{
 		x:          0,
-		y:          2,
+		y:          EDITOR_LINE,
 		w:          width,
-		h:          height,
+		h:          height - EDITOR_LINE - NUM_LOG_LINES - 1, // and the status line
 		scrollable: true,
 		multiline:  true,
 		editable:   true,
 		content:    NewEditor(),
 	}
 	editorArea.showLineNumbers = true
+	cursors = newCursors(editorArea.content)
+	editorArea.cursors = cursors
 	logArea = &ViewArea{
 		x:         0,
 		y:         height - 5,
@@ -350,10 +528,39 @@ func setupAreas() {
 		multiline: true,
 		content:   NewEditor(),
 	}
-	menuArea = NewWideLineThing(0, 0, MENU_DISABLED_STYLE, "Q)uit T)ools R)efactor S)earch")
+	menuArea = NewWideLineThing(0, 0, MENU_DISABLED_STYLE, "Q)uit T)ools R)efactor S)earch F)ind in files H)istory")
 	tabsArea = NewWideLineThing(0, 1, FILE_TAB_STYLE, "File Tabs")
 }
 
+// fileCursors keeps the cursors of every file that has been shown, so going
+// back to a file finds them where they were.
+var fileCursors = make(map[string]*editors.Cursors)
+
+func newCursors(e editors.Editor) *editors.Cursors {
+	c := editors.NewCursors(e, editors.Position{})
+	c.TabWidth = TAB_WIDTH
+	return c
+}
+
+// showFile puts a loaded file in the editor area.
+func showFile(filePath string) {
+	f, ok := files[filePath]
+	if !ok || filePath == currentFile {
+		return
+	}
+	endTyping()
+	if fileCursors[filePath] == nil {
+		fileCursors[filePath] = newCursors(f)
+	}
+	currentFile = filePath
+	cursors = fileCursors[filePath]
+	editorArea.content = f
+	editorArea.cursors = cursors
+	editorArea.topVisibleLine = 0
+	syncCursor()
+	drawFileTabs()
+}
+
 func loadFiles() {
 	cwd, err := os.Getwd()
 	poe(err)
@@ -376,54 +583,30 @@ func loadFiles() {
 	poe(err)
 }
 
+// setCursor drops every cursor but one, at column ax of line ay.
 func setCursor(ax, ay int) {
-	if cx < 0 {
-		logf("Invalid cursor position: %d, %d", cx, cy)
-		return
-	}
-	cx = ax
-	cy = ay
-	screen.ShowCursor(cx+7, cy+EDITOR_LINE)
+	cursors.Reset(editors.Position{Line: ay, Column: ax})
+	syncCursor()
 }
 
-func moveCursor(dx, dy int) {
+// syncCursor points cx and cy at the primary cursor, scrolls the editor area
+// so it is visible and shows it.
+func syncCursor() {
 	width, height := screen.Size()
-	f := editorArea.content
-	nx := cx + dx
-	ny := cy + dy
-	if ny >= f.Length() || ny < 0 {
-		logf("Invalid cursor YY position: %d, %d", nx, ny)
-		return
-	}
-	line, _ := f.GetLine(ny)
-	if nx < 0 {
-		logf("Invalid cursor XX position: %d, %d %+v", nx, ny, line)
-		return
-	}
-	if nx >= len(line) {
-		nx = len(line) - 1
-	}
-
-	x := nx
-	y := ny
-	if x >= width || y >= height-NUM_LOG_LINES {
-		logf("Invalid cursor XX,YY position: %d, %d %+v", x, y, line)
-		return
+	head := cursors.Primary().Head
+	cx, cy = head.Column, head.Line
+	drawText(50, 0, CODE_DEFAULT_STYLE, "(%3d,%3d)", cx, cy)
+	if cy < editorArea.topVisibleLine {
+		editorArea.topVisibleLine = cy
+	} else if cy >= editorArea.topVisibleLine+editorArea.h {
+		editorArea.topVisibleLine = cy - editorArea.h + 1
 	}
-
-	cx = nx
-	cy = ny
-
-	//if cx >= len(line) {
-	//	cx = len(line) - 1
-	//	x = cx + LINE_NUMBERS_WIDTH
-	//}
-	if cx < 0 || cy < 0 {
-		poe(fmt.Errorf("invalid cursor position: %d, %d", cx, cy))
+	line, _ := editorArea.content.GetLine(cy)
+	if x, y := editors.VisualColumn(line, cx, TAB_WIDTH)+TEXT_COLUMN, cy-editorArea.topVisibleLine+EDITOR_LINE; x < width && y < height-NUM_LOG_LINES {
+		screen.ShowCursor(x, y)
+	} else {
+		screen.HideCursor()
 	}
-	drawText(50, 0, CODE_DEFAULT_STYLE, "(%3d,%3d)", cx, cy)
-	//	screen.HideCursor()
-	screen.ShowCursor(x+7, y+EDITOR_LINE)
 }
 
 func drawText(x, y int, style tcell.Style, format string, args ...any) {
@@ -439,24 +622,58 @@ func loadFile(filePath string) {
 	poe(err)
 	f := NewEditor()
 
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	lineNumber := 0
-	for scanner.Scan() {
-		line := scanner.Text()
+	lines, format, err := decodeFile(content)
+	if err != nil {
+		logf("%s is loaded as %s: %v", filePath, format.encoding, err)
+	}
+	for lineNumber, line := range lines {
 		f.InsertLine(lineNumber, line)
-		lineNumber++
 	}
-	if err := scanner.Err(); err != nil {
-		poe(err) // Handle any potential scanning errors
+	// loading isn't something to undo
+	f.ClearHistory()
+	if _, err := loadUndoHistory(filePath, f); err != nil {
+		logf("Error loading undo history of %s: %v", filePath, err)
 	}
+	f.MarkSaved()
 	files[filePath] = f
+	fileInfos[filePath] = newFileInfo(content, lines, format)
+	if err := watchFile(filePath); err != nil {
+		logf("Error watching %s: %v", filePath, err)
+	}
+	if err := openJournal(filePath); err != nil {
+		logf("Error looking for unsaved edits of %s: %v", filePath, err)
+	}
 }
 
+// drawnTabs is what drawFileTabs drew last, the tabs are only drawn again when
+// they change.
+var drawnTabs = ""
+
+// drawFileTabs draws a tab per file, the one shown reversed and the ones with
+// unsaved changes marked with a '*'.
 func drawFileTabs() {
+	if tabsArea == nil {
+		return
+	}
 	sortedNames := make([]string, 0, len(files))
 	for name := range files {
 		sortedNames = append(sortedNames, name)
 	}
+	slices.Sort(sortedNames)
+
+	tabs := make([]string, len(sortedNames))
+	for i, name := range sortedNames {
+		marker := " "
+		if isModified(name) {
+			marker = "*"
+		}
+		tabs[i] = fmt.Sprintf("%d)%s%-15s ", i+1, marker, name[:min(len(name), 15)])
+	}
+	if all := currentFile + "\x00" + strings.Join(tabs, "\x00"); all == drawnTabs {
+		return
+	} else {
+		drawnTabs = all
+	}
 
 	cx := 0
 	for i, name := range sortedNames {
@@ -464,8 +681,7 @@ func drawFileTabs() {
 		if name == currentFile {
 			style = style.Reverse(true)
 		}
-		msg := fmt.Sprintf("%d) %-15s ", i+1, name[:min(len(name), 15)])
-		tabsArea.placeText(0, cx, msg, style)
+		tabsArea.placeText(0, cx, tabs[i], style)
 		cx += 20
 	}
 
@@ -496,6 +712,9 @@ func initLsp(stdin io.WriteCloser) {
 	} else {
 		logf("lsp: didopencomplete %+v", resp)
 	}
+	if f, ok := files["testdata/testprogram.go"]; ok {
+		f.Subscribe(didChangeSender(stdin, "testdata/testprogram.go", f))
+	}
 
 	if resp, err := sendSyntax(stdin); err != nil {
 		logf("Error sending syntax request: %v", err)
@@ -635,6 +854,48 @@ func sendDidOpen(stdinWriter io.Writer, filePath string) (rslt Response[NULL_PAR
 	return
 }
 
+// didChangeSender returns a change subscriber that tells gopls about every
+// edit made to the open file, so its copy stays in sync.
+func didChangeSender(stdin io.Writer, filePath string, f editors.Editor) func(editors.ChangeEvent) {
+	absPath, err := filepath.Abs(filePath)
+	poe(err)
+	uri := lsp.DocumentURI("file://" + absPath)
+	return func(ev editors.ChangeEvent) {
+		// LSP counts columns in UTF-16 code units.  The text in front of the
+		// start of the change is the same as before it, the text in front of
+		// its old end is what was replaced.
+		line, _ := f.GetLine(ev.Start.Line)
+		start := utf16Length(line[:min(ev.Start.Column, len(line))])
+		old := []rune(ev.OldText)
+		end := start + utf16Length(old)
+		if i := strings.LastIndex(ev.OldText, "\n"); i >= 0 {
+			end = utf16Length([]rune(ev.OldText[i+1:]))
+		}
+		rq := req[lsp.DidChangeTextDocumentParams]("textDocument/didChange", lsp.DidChangeTextDocumentParams{
+			TextDocument: lsp.VersionedTextDocumentIdentifier{
+				TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri},
+				// didOpen sent version 1
+				Version: ev.Version + 1,
+			},
+			ContentChanges: []lsp.TextDocumentContentChangeEvent{{
+				Range: &lsp.Range{
+					Start: lsp.Position{Line: ev.Start.Line, Character: start},
+					End:   lsp.Position{Line: ev.End.Line, Character: end},
+				},
+				RangeLength: uint(utf16Length(old)),
+				Text:        ev.Text,
+			}},
+		})
+		if err := sendAsync(stdin, rq); err != nil {
+			logf("Error sending didChange: %v", err)
+		}
+	}
+}
+
+func utf16Length(runes []rune) int {
+	return len(utf16.Encode(runes))
+}
+
 func listenForErrors(errPipe io.ReadCloser) {
 	scanner := bufio.NewScanner(errPipe)
 	for scanner.Scan() {
@@ -745,7 +1006,6 @@ func listenToGopls(stdout io.ReadCloser) {
 		logf("No listener for %d", resp.ID)
 
 	}
-	return
 }
 
 func drawBox(x1, y1, x2, y2 int, style tcell.Style, text string) {
@@ -882,15 +1142,30 @@ type ViewArea struct {
 	topVisibleLine  int
 	focus           bool
 	showLineNumbers bool
+	cursors         *editors.Cursors // drawn when set
+	search          *editors.Search  // its matches are highlighted when set
 }
 
 func (va *ViewArea) render() {
 	if va != nil && va.content != nil {
+		_, height := screen.Size()
+		var visible []lineCursors
+		if va.cursors != nil {
+			visible = visibleCursors(va.cursors.Selections(), va.cursors.Primary().Head, va.topVisibleLine, max(va.h, 0))
+		}
 		y := va.y
-		for ln := 0; ln < va.content.Length(); ln++ {
+		for ln := va.topVisibleLine; ln < va.content.Length() && y < min(va.y+va.h, height); ln++ {
 			x := va.x
+			var lc lineCursors
+			if i := ln - va.topVisibleLine; i < len(visible) {
+				lc = visible[i]
+			}
 
 			line, styles := va.content.GetLine(ln)
+			var matches [][2]int
+			if va.search != nil {
+				matches = va.search.Line(line)
+			}
 			if va.showLineNumbers {
 				ls := fmt.Sprintf("%4d:", ln+1)
 				for _, r := range ls {
@@ -899,25 +1174,122 @@ func (va *ViewArea) render() {
 				}
 			}
 			x++
+			start := x
 			for pos, r := range line {
-				screen.SetContent(x, y, r, nil, styles[pos])
-				x++
+				// tabs are drawn as spaces up to the next tab stop, the '\r'
+				// kept at the end of lines of files with mixed line endings
+				// as a symbol
+				next := x + 1
+				if r == '\t' {
+					r = ' '
+					next = start + ((x-start)/TAB_WIDTH+1)*TAB_WIDTH
+				} else if r == '\r' {
+					r = '␍'
+				}
+				style := styles[pos]
+				for len(matches) > 0 && matches[0][1] <= pos {
+					matches = matches[1:]
+				}
+				if len(matches) > 0 && matches[0][0] <= pos {
+					style = MATCH_STYLE
+				}
+				for ; x < next; x++ {
+					screen.SetContent(x, y, r, nil, lc.style(pos, style))
+				}
 			}
-			for x < va.w {
-				screen.SetContent(x, y, ' ', nil, CODE_DEFAULT_STYLE)
+			for pos := len(line); x < va.w; pos++ {
+				screen.SetContent(x, y, ' ', nil, lc.style(pos, CODE_DEFAULT_STYLE))
 				x++
 			}
 
 			y++
 		}
+		if va.scrollable {
+			// whatever was shown before scrolling or switching files
+			for ; y < min(va.y+va.h, height); y++ {
+				for x := va.x; x < va.x+va.w; x++ {
+					screen.SetContent(x, y, ' ', nil, CODE_DEFAULT_STYLE)
+				}
+			}
+		}
 	}
 }
 
+// lineCursors are the selected columns of a line and the cursors on it besides
+// the primary one, which the terminal shows, in order so they are gone through
+// along with the characters of the line.
+type lineCursors struct {
+	spans [][2]int // from and to, to is -1 when the selection goes past the line
+	heads []int
+}
+
+// visibleCursors sorts the selections out by line for count lines from first
+// on, once for drawing them all.
+func visibleCursors(selections []editors.Selection, primary editors.Position, first, count int) []lineCursors {
+	rtn := make([]lineCursors, count)
+	last := first + count - 1
+	for _, sel := range selections {
+		if sel.Head != primary && sel.Head.Line >= first && sel.Head.Line <= last {
+			lc := &rtn[sel.Head.Line-first]
+			lc.heads = append(lc.heads, sel.Head.Column)
+		}
+		start, end := sel.Range()
+		for line := max(start.Line, first); line <= min(end.Line, last); line++ {
+			from, to := 0, -1
+			if line == start.Line {
+				from = start.Column
+			}
+			if line == end.Line {
+				to = end.Column
+			}
+			if from != to {
+				lc := &rtn[line-first]
+				lc.spans = append(lc.spans, [2]int{from, to})
+			}
+		}
+	}
+	for i := range rtn {
+		slices.Sort(rtn[i].heads)
+		slices.SortFunc(rtn[i].spans, func(a, b [2]int) int { return a[0] - b[0] })
+	}
+	return rtn
+}
+
+// style returns the style to draw the character at column with: selected text
+// is highlighted and the cursors are drawn reversed.  Columns have to be asked
+// for in order.
+func (lc *lineCursors) style(column int, style tcell.Style) tcell.Style {
+	for len(lc.heads) > 0 && lc.heads[0] < column {
+		lc.heads = lc.heads[1:]
+	}
+	if len(lc.heads) > 0 && lc.heads[0] == column {
+		return style.Reverse(true)
+	}
+	for len(lc.spans) > 0 && lc.spans[0][1] >= 0 && lc.spans[0][1] <= column {
+		lc.spans = lc.spans[1:]
+	}
+	if len(lc.spans) > 0 && lc.spans[0][0] <= column {
+		return SELECTION_STYLE
+	}
+	return style
+}
+
+// placeText writes msg over the line from column pos on, padding the line with
+// spaces when it is shorter than that.
 func (va *ViewArea) placeText(line int, pos int, msg string, style tcell.Style) {
 	if va.content == nil {
 		va.content = NewEditor()
 	}
-	va.content.InsertText(line, pos, msg, style)
+	for va.content.Length() <= line {
+		va.content.InsertLine(va.content.Length(), "")
+	}
+	text, _ := va.content.GetLine(line)
+	if len(text) < pos {
+		va.content.InsertText(line, len(text), strings.Repeat(" ", pos-len(text)), style)
+		text, _ = va.content.GetLine(line)
+	}
+	end := min(pos+len([]rune(msg)), len(text))
+	va.content.ReplaceRange(editors.Position{Line: line, Column: pos}, editors.Position{Line: line, Column: end}, msg, style)
 }
 
 func (va *ViewArea) FillStyle(style tcell.Style) {
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackgroundLogf(t *testing.T) {
+	filePath, _ := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	shown := logLines[0]
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		backgroundLogf("Error from the background: %d", 42)
+	}()
+	<-done
+	// in the log file straight away, on the screen once the key loop has it
+	data, err := os.ReadFile("goedit.log")
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "Error from the background: 42")
+	assert.Equal(t, shown, logLines[0])
+	for {
+		if ev, ok := screen.PollEvent().(*tcell.EventInterrupt); ok {
+			if msg, ok := ev.Data().(logMessage); ok {
+				assert.Equal(t, logMessage("Error from the background: 42"), msg)
+				break
+			}
+		}
+	}
+}
+
+func TestVisibleCursors(t *testing.T) {
+	pos := func(line, column int) editors.Position { return editors.Position{Line: line, Column: column} }
+	selections := []editors.Selection{
+		{Head: pos(1, 2), Tail: pos(1, 2)},
+		{Head: pos(2, 1), Tail: pos(4, 3)},
+		{Head: pos(5, 4), Tail: pos(5, 1)},
+		{Head: pos(9, 0), Tail: pos(9, 0)}, // not visible
+	}
+	// what every selection means for a character, looked at one by one
+	want := func(line, column int) tcell.Style {
+		p := pos(line, column)
+		style := CODE_DEFAULT_STYLE
+		for _, sel := range selections {
+			if sel.Head == p && p != pos(5, 4) {
+				return style.Reverse(true)
+			}
+			if start, end := sel.Range(); !p.Before(start) && p.Before(end) {
+				style = SELECTION_STYLE
+			}
+		}
+		return style
+	}
+
+	visible := visibleCursors(selections, pos(5, 4), 1, 6)
+	assert.Len(t, visible, 6)
+	for i := range visible {
+		for column := 0; column < 10; column++ {
+			assert.Equal(t, want(i+1, column), visible[i].style(column, CODE_DEFAULT_STYLE), "%d:%d", i+1, column)
+		}
+	}
+}
+
+func TestDrawManyCursors(t *testing.T) {
+	lines := make([]string, 5000)
+	for i := range lines {
+		lines[i] = "some text on a line"
+	}
+	filePath, f := loadTestFile(t, lines...)
+	showTestFile(t, filePath)
+	cursors.Set([]editors.Selection{{Head: editors.Position{Line: f.Length()}, Tail: editors.Position{}}})
+	cursors.SplitLines()
+	assert.Len(t, cursors.Selections(), 5000)
+
+	start := time.Now()
+	for range 20 {
+		editorArea.render()
+	}
+	assert.Less(t, time.Since(start), 2*time.Second)
+	// the first line is selected from the start of it
+	x := editorArea.x + 1
+	if editorArea.showLineNumbers {
+		x += 5
+	}
+	cell, _, style, _ := screen.GetContent(x, editorArea.y)
+	assert.Equal(t, 's', cell)
+	assert.Equal(t, SELECTION_STYLE, style)
+}
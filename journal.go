@@ -0,0 +1,312 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+// Unsaved edits are journaled so they survive goedit crashing.  The journal of
+// a file is kept in the user's cache directory, named like its undo history.
+// It starts with the first edit after the file was loaded or saved, with a line
+// holding the text after that edit, and gets a line for every edit after it.
+// A goroutine of its own writes the journals, so editing doesn't wait for the
+// disk.  Saving a file removes its journal and so does exiting normally, a
+// journal newer than its file found when loading the file is what is left of
+// a crash, and recovering it is offered.
+
+type journalHeader struct {
+	Path string
+	Text []string
+}
+
+type journalEdit struct {
+	Start, End editors.Position
+	Text       string
+}
+
+// journalWrite appends data to a journal, starting it afresh if start is set,
+// or removes the journal if data is nil.
+type journalWrite struct {
+	path  string
+	data  []byte
+	start bool
+}
+
+var journalWrites = make(chan journalWrite, 1024)
+var journalDone = make(chan struct{})
+var journalWriting = false
+
+// journal is the state of the journal of a loaded file.
+type journal struct {
+	filePath string
+	path     string
+	started  bool
+}
+
+var journals = make(map[string]*journal)
+
+// openJournal journals the edits of a file just loaded.  A journal left by a
+// crash is put up for recovery first.
+func openJournal(filePath string) error {
+	path, err := cachePath("recovery", filePath, ".journal")
+	if err != nil {
+		return err
+	}
+	j := &journal{filePath: filePath, path: path}
+	journals[filePath] = j
+	files[filePath].Subscribe(j.changed)
+	return findRecovery(filePath, path)
+}
+
+func (j *journal) changed(ev editors.ChangeEvent) {
+	var record any = journalEdit{ev.Start, ev.End, ev.Text}
+	if !j.started {
+		abs, _ := filepath.Abs(j.filePath)
+		record = journalHeader{abs, editorLines(files[j.filePath])}
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		logf("Error journaling %s: %v", j.filePath, err)
+		return
+	}
+	sendJournalWrite(journalWrite{path: j.path, data: append(data, '\n'), start: !j.started})
+	j.started = true
+}
+
+// resetJournal removes the journal of a file whose text is saved, the next
+// edit starts a new one.
+func resetJournal(filePath string) {
+	if j, ok := journals[filePath]; ok && j.started {
+		sendJournalWrite(journalWrite{path: j.path})
+		j.started = false
+	}
+}
+
+func sendJournalWrite(w journalWrite) {
+	if !journalWriting {
+		journalWriting = true
+		go writeJournals()
+	}
+	journalWrites <- w
+}
+
+// closeJournals waits for the journals to be written, and removes them if
+// goedit is exiting normally.
+func closeJournals(remove bool) {
+	if remove {
+		for filePath := range journals {
+			resetJournal(filePath)
+		}
+	}
+	if !journalWriting {
+		return
+	}
+	close(journalWrites)
+	<-journalDone
+}
+
+// writeJournals writes the journals until journalWrites is closed, syncing
+// them whenever it has caught up.
+func writeJournals() {
+	defer close(journalDone)
+	open := make(map[string]*os.File)
+	for w := range journalWrites {
+		if err := writeJournal(open, w); err != nil {
+			backgroundLogf("Error writing journal %s: %v", w.path, err)
+		}
+		if len(journalWrites) == 0 {
+			for _, f := range open {
+				if err := f.Sync(); err != nil {
+					backgroundLogf("Error syncing journal %s: %v", f.Name(), err)
+				}
+			}
+		}
+	}
+	for _, f := range open {
+		f.Close()
+	}
+}
+
+func writeJournal(open map[string]*os.File, w journalWrite) error {
+	f := open[w.path]
+	if f != nil && (w.start || w.data == nil) {
+		f.Close()
+		delete(open, w.path)
+		f = nil
+	}
+	if w.data == nil {
+		if err := os.Remove(w.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if f == nil {
+		if err := os.MkdirAll(filepath.Dir(w.path), 0700); err != nil {
+			return err
+		}
+		flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+		if w.start {
+			flags |= os.O_TRUNC
+		}
+		var err error
+		if f, err = os.OpenFile(w.path, flags, 0600); err != nil {
+			return err
+		}
+		open[w.path] = f
+	}
+	_, err := f.Write(w.data)
+	return err
+}
+
+// readJournal returns the text a journal ends in.  A last line cut short by a
+// crash is left out.
+func readJournal(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading journal header: %w", err)
+	}
+	var header journalHeader
+	if err := json.Unmarshal(line, &header); err != nil {
+		return nil, fmt.Errorf("reading journal header: %w", err)
+	}
+	e := NewEditor()
+	for n, text := range header.Text {
+		e.InsertLine(n, text)
+	}
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		var edit journalEdit
+		if err := json.Unmarshal(line, &edit); err != nil {
+			return nil, err
+		}
+		if !inText(e, edit.Start) || !inText(e, edit.End) {
+			return nil, errors.New("journal edit outside of the text")
+		}
+		e.ReplaceRange(edit.Start, edit.End, edit.Text, CODE_DEFAULT_STYLE)
+	}
+	return editorLines(e), nil
+}
+
+// inText reports whether pos is a position in the text of e, the start of the
+// line after the last one, the end of the text, included.
+func inText(e editors.Editor, pos editors.Position) bool {
+	if pos.Line == e.Length() {
+		return pos.Column == 0
+	}
+	return pos.Line >= 0 && pos.Line < e.Length() && pos.Column >= 0 && pos.Column <= lineLength(e, pos.Line)
+}
+
+// recovery is a journal left by a crash.
+type recovery struct {
+	filePath string
+	path     string
+	lines    []string // the text it recovers
+	written  time.Time
+}
+
+// recoveries are the journals left by a crash not yet offered.
+var recoveries []recovery
+
+// findRecovery looks for a journal left by a crash for a file just loaded.  One
+// older than the file has been overtaken by saving the file some other way and
+// is removed, as is one with nothing to recover.
+func findRecovery(filePath, path string) error {
+	journalInfo, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if !journalInfo.ModTime().After(info.ModTime()) {
+		logf("Removing the journal of %s, the file is newer", filePath)
+		return os.Remove(path)
+	}
+	lines, err := readJournal(path)
+	if err != nil {
+		return err
+	}
+	if slices.Equal(lines, editorLines(files[filePath])) {
+		return os.Remove(path)
+	}
+	recoveries = append(recoveries, recovery{filePath, path, lines, journalInfo.ModTime()})
+	return nil
+}
+
+// checkRecoveries offers the next journal left by a crash, unless a panel is
+// open.
+func checkRecoveries() {
+	if activePanel == nil && len(recoveries) > 0 {
+		activePanel = &recoverPanel{recovery: recoveries[0]}
+		recoveries = recoveries[1:]
+	}
+}
+
+// recoverPanel offers to put the edits a journal left by a crash holds into
+// the buffer of the file, or to throw them away, and shows how they differ from
+// the file.
+type recoverPanel struct {
+	recovery
+	diff     []string
+	selected int
+}
+
+func (p *recoverPanel) draw() {
+	if p.diff != nil {
+		drawList(fmt.Sprintf("Unsaved edits of %s: R)ecover  D)iscard  Up/Down scroll", p.filePath), p.diff, p.selected)
+		return
+	}
+	drawList(fmt.Sprintf("%s has unsaved edits: R)ecover  V)iew diff  D)iscard", p.filePath), []string{
+		fmt.Sprintf("goedit didn't exit normally, the edits were made up to %s.", p.written.Format(time.DateTime)),
+		"Recover puts them in the buffer, undo takes them out again.",
+		"Discard throws them away for good.",
+	}, -1)
+}
+
+func (p *recoverPanel) handleKey(ev *tcell.EventKey) bool {
+	switch {
+	case ev.Rune() == 'r' || ev.Rune() == 'R':
+		replaceText(p.filePath, p.lines)
+		setStatus("Recovered the unsaved edits of %s", p.filePath)
+	case ev.Rune() == 'd' || ev.Rune() == 'D':
+		if err := os.Remove(p.path); err != nil && !os.IsNotExist(err) {
+			statusError(err)
+		}
+	case ev.Rune() == 'v' || ev.Rune() == 'V':
+		p.diff = editors.Diff(editorLines(files[p.filePath]), p.lines)
+		return true
+	case ev.Key() == tcell.KeyUp:
+		p.selected = max(p.selected-1, 0)
+		return true
+	case ev.Key() == tcell.KeyDown:
+		p.selected = min(p.selected+1, len(p.diff)-1)
+		return true
+	default:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJournalReplay(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two")
+	assert.NoError(t, openJournal(filePath))
+
+	// edits at the end of the text and of the whole of it
+	f.ReplaceRange(editors.Position{Line: 2}, editors.Position{Line: 2}, "three\n", CODE_DEFAULT_STYLE)
+	f.InsertText(0, 3, " and", CODE_DEFAULT_STYLE)
+	f.DeleteRange(editors.Position{Line: 2}, editors.Position{Line: 3})
+	f.Undo()
+	f.DeleteRange(editors.Position{Line: 1}, editors.Position{Line: f.Length()})
+	replaceText(filePath, []string{"x", "y", "z"})
+	f.InsertText(2, 1, "!", CODE_DEFAULT_STYLE)
+	closeJournals(false)
+
+	lines, err := readJournal(journals[filePath].path)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"x", "y", "z!"}, lines)
+	assert.Equal(t, editorLines(f), lines)
+}
+
+func TestJournalRemovedWhenSaved(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	assert.NoError(t, openJournal(filePath))
+	f.InsertText(0, 0, "x", CODE_DEFAULT_STYLE)
+	assert.NoError(t, saveFile(filePath))
+	closeJournals(false)
+	_, err := os.Stat(journals[filePath].path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestJournalRecovery(t *testing.T) {
+	filePath, f := loadTestFile(t, "one", "two")
+	assert.NoError(t, openJournal(filePath))
+	f.InsertText(1, 0, "unsaved ", CODE_DEFAULT_STYLE)
+	closeJournals(false)
+	past := time.Now().Add(-time.Minute)
+	assert.NoError(t, os.Chtimes(filePath, past, past))
+
+	// loading the file again after a crash offers the edits
+	again := NewEditor()
+	again.InsertLine(0, "one")
+	again.InsertLine(1, "two")
+	files[filePath] = again
+	assert.NoError(t, openJournal(filePath))
+	if assert.Len(t, recoveries, 1) {
+		assert.Equal(t, []string{"one", "unsaved two"}, recoveries[0].lines)
+	}
+}
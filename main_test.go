@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestMain runs the tests in a directory of their own, for goedit.log.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "goedit-test-")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		panic(err)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// loadTestFile loads a file with the given lines the way loadFile does, with a
+// fresh journal, and puts things back when the test ends.
+func loadTestFile(t *testing.T, lines ...string) (string, editors.Editor) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	filePath := filepath.Join(t.TempDir(), "file.txt")
+	content := []byte(joinLines(lines))
+	assert.NoError(t, os.WriteFile(filePath, content, 0644))
+	f := newTestEditor(lines)
+	f.ClearHistory()
+	f.MarkSaved()
+	files[filePath] = f
+	fileInfos[filePath] = newFileInfo(content, lines, fileFormat{lineEnding: LF, finalNewline: true})
+	t.Cleanup(func() {
+		delete(files, filePath)
+		delete(fileInfos, filePath)
+		journals = make(map[string]*journal)
+		journalWrites = make(chan journalWrite, 1024)
+		journalDone = make(chan struct{})
+		journalWriting = false
+		recoveries = nil
+	})
+	return filePath, f
+}
+
+func joinLines(lines []string) string {
+	text := ""
+	for _, line := range lines {
+		text += line + "\n"
+	}
+	return text
+}
+
+// showTestFile shows a loaded file on a simulated screen.
+func showTestFile(t *testing.T, filePath string) {
+	screen = tcell.NewSimulationScreen("")
+	assert.NoError(t, screen.Init())
+	screen.SetSize(80, 25)
+	setupAreas()
+	showFile(filePath)
+	t.Cleanup(func() {
+		screen.Fini()
+		screen, editorArea, logArea, menuArea, tabsArea, cursors = nil, nil, nil, nil, nil, nil
+		currentFile, drawnTabs = "", ""
+		fileCursors = make(map[string]*editors.Cursors)
+	})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// chown does nothing where files don't have a Unix owner.
+func chown(f *os.File, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// chown gives f the owner and group of the file described by info, unless it
+// has them already.
+func chown(f *os.File, info os.FileInfo) error {
+	want, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if mine, err := f.Stat(); err == nil {
+		if have, ok := mine.Sys().(*syscall.Stat_t); ok && have.Uid == want.Uid && have.Gid == want.Gid {
+			return nil
+		}
+	}
+	return f.Chown(int(want.Uid), int(want.Gid))
+}
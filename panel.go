@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+var PANEL_STYLE = tcell.Style{}.Foreground(tcell.ColorWhite).Background(tcell.ColorNavy)
+var PANEL_SELECTED_STYLE = PANEL_STYLE.Reverse(true)
+
+// panel is a window drawn over the editor area, while it is open it gets every
+// key press.
+type panel interface {
+	draw()
+	// handleKey returns false once the panel is done and should be closed.
+	handleKey(ev *tcell.EventKey) bool
+}
+
+var activePanel panel
+
+// panelBounds returns the corners of the box panels are drawn in.
+func panelBounds() (int, int, int, int) {
+	width, height := screen.Size()
+	return 4, EDITOR_LINE + 1, width - 5, height - NUM_LOG_LINES - 2
+}
+
+// drawList draws rows inside a panel box, scrolled so selected is visible.
+func drawList(title string, rows []string, selected int) {
+	x1, y1, x2, y2 := panelBounds()
+	drawBox(x1, y1, x2, y2, PANEL_STYLE, "")
+	drawText(x1+2, y1, PANEL_STYLE, " %s ", title)
+	visible := y2 - y1 - 1
+	top := max(0, selected-visible+1)
+	for i := 0; i < visible && top+i < len(rows); i++ {
+		style := PANEL_STYLE
+		if top+i == selected {
+			style = PANEL_SELECTED_STYLE
+		}
+		row := []rune(rows[top+i])
+		row = row[:min(len(row), x2-x1-1)]
+		drawText(x1+1, y1+1+i, style, "%-*s", x2-x1-1, string(row))
+	}
+}
+
+// undoPanel shows the undo tree of the editor area, newest state first, and
+// moves the text to whichever state is picked.
+type undoPanel struct {
+	states   []editors.HistoryState
+	selected int
+}
+
+func openUndoPanel() {
+	p := &undoPanel{}
+	p.refresh()
+	activePanel = p
+}
+
+func (p *undoPanel) refresh() {
+	p.states = editorArea.content.History()
+	for i, s := range p.states {
+		if s.Current {
+			p.selected = len(p.states) - 1 - i
+		}
+	}
+}
+
+func (p *undoPanel) draw() {
+	now := time.Now()
+	rows := make([]string, len(p.states))
+	for i := range p.states {
+		s := p.states[len(p.states)-1-i]
+		marker := " "
+		if s.Current {
+			marker = "*"
+		}
+		from := "start"
+		if s.Parent >= 0 {
+			from = fmt.Sprintf("from #%d", s.Parent)
+		}
+		branch := ""
+		if len(s.Children) == 0 && !s.Current {
+			branch = "[branch]"
+		}
+		ago := now.Sub(s.Time).Round(time.Second)
+		rows[i] = fmt.Sprintf("%s #%-4d %s %8s ago  %-10s %-8s %s", marker, s.ID, s.Time.Format("15:04:05"), ago, from, branch, strings.TrimSpace(s.Summary))
+	}
+	drawList("Undo history: Enter jump  -/+ a minute earlier/later  Esc close", rows, p.selected)
+}
+
+func (p *undoPanel) handleKey(ev *tcell.EventKey) bool {
+	var cursor editors.Position
+	var moved bool
+	switch {
+	case ev.Key() == tcell.KeyEscape:
+		return false
+	case ev.Key() == tcell.KeyUp:
+		p.selected = max(p.selected-1, 0)
+	case ev.Key() == tcell.KeyDown:
+		p.selected = min(p.selected+1, len(p.states)-1)
+	case ev.Key() == tcell.KeyEnter:
+		cursor, moved = editorArea.content.GotoState(p.states[len(p.states)-1-p.selected].ID)
+	case ev.Rune() == '-':
+		cursor, moved = editorArea.content.Earlier(time.Minute)
+	case ev.Rune() == '+':
+		cursor, moved = editorArea.content.Later(time.Minute)
+	}
+	if moved {
+		setCursor(cursor.Column, cursor.Line)
+		p.refresh()
+	}
+	return true
+}
+
+// quitting is set once goedit should exit.
+var quitting = false
+
+// requestQuit quits straight away when every file is saved, and otherwise asks
+// what to do with the unsaved changes first.
+func requestQuit() {
+	if modified := modifiedFiles(); len(modified) > 0 {
+		activePanel = &quitPanel{modified: modified}
+	} else {
+		quitting = true
+	}
+}
+
+// quitPanel lists the files with unsaved changes and quits after saving them
+// all or throwing the changes away, or goes back to editing.
+type quitPanel struct {
+	modified []string
+}
+
+func (p *quitPanel) draw() {
+	drawList("Unsaved changes: S)ave all  D)iscard  C)ancel", p.modified, -1)
+}
+
+func (p *quitPanel) handleKey(ev *tcell.EventKey) bool {
+	switch {
+	case ev.Rune() == 's' || ev.Rune() == 'S':
+		for _, name := range p.modified {
+			if err := saveFile(name); err != nil {
+				statusError(fmt.Errorf("saving %s: %w", name, err))
+				p.modified = modifiedFiles()
+				return true
+			}
+		}
+		quitting = true
+	case ev.Rune() == 'd' || ev.Rune() == 'D':
+		quitting = true
+	case ev.Rune() == 'c' || ev.Rune() == 'C' || ev.Key() == tcell.KeyEscape:
+	default:
+		return true
+	}
+	return false
+}
+
+// tool is a command run from the tools panel.
+type tool struct {
+	name string
+	run  func()
+}
+
+// toolsPanel lists commands and runs the one picked.
+type toolsPanel struct {
+	tools    []tool
+	selected int
+}
+
+func openToolsPanel(tools []tool) {
+	activePanel = &toolsPanel{tools: tools}
+}
+
+func (p *toolsPanel) draw() {
+	rows := make([]string, len(p.tools))
+	for i, t := range p.tools {
+		rows[i] = t.name
+	}
+	drawList("Tools: Enter run  Esc close", rows, p.selected)
+}
+
+func (p *toolsPanel) handleKey(ev *tcell.EventKey) bool {
+	switch ev.Key() {
+	case tcell.KeyEscape:
+		return false
+	case tcell.KeyUp:
+		p.selected = max(p.selected-1, 0)
+	case tcell.KeyDown:
+		p.selected = min(p.selected+1, len(p.tools)-1)
+	case tcell.KeyEnter:
+		p.tools[p.selected].run()
+		return false
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// quitWith asks to quit and presses key in the panel listing the modified
+// files.
+func quitWith(t *testing.T, key rune) (stays bool) {
+	t.Helper()
+	t.Cleanup(func() { activePanel, quitting = nil, false })
+	requestQuit()
+	if !assert.IsType(t, &quitPanel{}, activePanel) {
+		return false
+	}
+	activePanel.draw()
+	stays = activePanel.handleKey(tcell.NewEventKey(tcell.KeyRune, key, tcell.ModNone))
+	if !stays {
+		activePanel = nil
+	}
+	return stays
+}
+
+func TestQuitWithoutModifiedFiles(t *testing.T) {
+	filePath, _ := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	t.Cleanup(func() { activePanel, quitting = nil, false })
+	requestQuit()
+	assert.Nil(t, activePanel)
+	assert.True(t, quitting)
+}
+
+func TestQuitListsModifiedFiles(t *testing.T) {
+	clean, _ := loadTestFile(t, "one")
+	b, fb := loadTestFile(t, "two")
+	a, fa := loadTestFile(t, "three")
+	showTestFile(t, clean)
+	fa.InsertText(0, 0, "x", CODE_DEFAULT_STYLE)
+	fb.InsertText(0, 0, "x", CODE_DEFAULT_STYLE)
+	t.Cleanup(func() { activePanel, quitting = nil, false })
+
+	requestQuit()
+	if assert.IsType(t, &quitPanel{}, activePanel) {
+		assert.ElementsMatch(t, []string{a, b}, activePanel.(*quitPanel).modified)
+		activePanel.draw()
+	}
+	assert.False(t, quitting)
+}
+
+func TestQuitSavingAll(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	f.InsertText(0, 3, " saved", CODE_DEFAULT_STYLE)
+	assert.False(t, quitWith(t, 's'))
+	assert.True(t, quitting)
+	assertFile(t, filePath, "one saved\n")
+	assert.False(t, isModified(filePath))
+}
+
+func TestQuitSaveFails(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	f.InsertText(0, 3, " unsaved", CODE_DEFAULT_STYLE)
+	// a directory in the way of the file
+	assert.NoError(t, os.Remove(filePath))
+	assert.NoError(t, os.Mkdir(filePath, 0755))
+
+	assert.True(t, quitWith(t, 'S'))
+	assert.False(t, quitting)
+	assert.True(t, statusIsError)
+	assert.Equal(t, []string{filePath}, activePanel.(*quitPanel).modified)
+}
+
+func TestQuitDiscarding(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	f.InsertText(0, 3, " unsaved", CODE_DEFAULT_STYLE)
+	assert.False(t, quitWith(t, 'd'))
+	assert.True(t, quitting)
+	assertFile(t, filePath, "one\n")
+}
+
+func TestQuitCancelled(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	showTestFile(t, filePath)
+	f.InsertText(0, 3, " unsaved", CODE_DEFAULT_STYLE)
+	assert.False(t, quitWith(t, 'c'))
+	assert.False(t, quitting)
+	assert.Equal(t, []string{"one unsaved"}, editorLines(f))
+	assert.True(t, isModified(filePath))
+	assertFile(t, filePath, "one\n")
+
+	// other keys keep asking
+	assert.True(t, quitWith(t, 'x'))
+	assert.False(t, quitting)
+}
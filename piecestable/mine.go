@@ -1,152 +1,310 @@
 package piecestable
 
+import (
+	"bytes"
+	"slices"
+	"unicode/utf8"
+)
+
 func NewEditor(s string) Editor {
 	var tm = new(TextManager)
 	tm.originBuffer = []byte(s)
-	tm.redoStack = make([]State, 0)
-	tm.pieceTable = make([]State, 1)
-	var st = new(State)
-	st.pieces = make([]Piece, 1)
-	st.pieces[0] = Piece{true, 0, len(s)}
-	tm.pieceTable[0] = *st
+	tm.root = build(tm.pieces(true, 0, len(s)))
+	tm.undoLimit = -1
 	return tm
 }
 
-func (tm *TextManager) getCurrentState() State {
-	return tm.pieceTable[len(tm.pieceTable)-1]
-}
-
-func (tm *TextManager) setNewState(s State) {
-	tm.pieceTable = append(tm.pieceTable, s)
-}
-
 func (tm *TextManager) Insert(position uint, text string) Editor {
+	if len(text) == 0 {
+		return tm
+	}
 	offset := len(tm.addBuffer) //len(nil) == 0
 
-	tm.redoStack = tm.redoStack[:0]
-
 	if tm.addBuffer == nil {
 		tm.addBuffer = []byte(text)
 	} else {
 		tm.addBuffer = append(tm.addBuffer, []byte(text)...)
 	}
-	piece := Piece{false, offset, len(text)}
 
-	state := tm.getCurrentState()
-	if length := (uint)(len(tm.String())); position >= length {
-		state.pieces = append(state.pieces, piece)
-	} else if position == 0 {
-		state.pieces = append([]Piece{piece}, state.pieces...)
-	} else {
-		var bytes uint = 0
-
-		for index, p := range state.pieces {
-			bytes += (uint)(p.length)
-			if bytes > position {
-				i := (int)(position - (bytes - (uint)(p.length)))
-				p1 := Piece{p.origin, p.offset, i}
-				p2 := Piece{p.origin, p.offset + i, p.length - i}
-				toAppend := []Piece{p1, piece, p2}
-				if index+1 < len(state.pieces) {
-					toAppend = append(toAppend, state.pieces[index+1:]...)
-				}
-				state.pieces = append(state.pieces[:index], toAppend...)
-				break
-			}
+	position = uint(tm.runeStart(min(int(position), size(tm.root))))
+	c := change{offset: int(position), added: tm.pieces(false, offset, len(text))}
+	if last, start, ok := tm.pieceAt(int(position) - 1); ok && start+last.length == int(position) {
+		// typing appends to the add buffer right where the previous insert
+		// ended, grow that piece rather than adding one per keystroke
+		if !last.origin && last.offset+last.length == offset && last.length+len(text) <= maxPieceLength {
+			grown := last
+			grown.length += len(text)
+			grown.lines += bytes.Count([]byte(text), []byte{'\n'})
+			grown.runes += utf8.RuneCountInString(text)
+			c = change{offset: start, removed: []Piece{last}, added: []Piece{grown}}
 		}
 	}
-	tm.setNewState(state)
+	tm.apply(c.offset, total(c.removed), c.added)
+	tm.record(c)
 	return tm
 }
 
 func (tm *TextManager) Delete(offset, length uint) Editor {
-	contentLength := (uint)(len(tm.String()))
-	if offset > contentLength {
+	contentLength := tm.Len()
+	if offset >= contentLength || length == 0 {
 		return tm
 	}
 	if offset+length > contentLength {
 		length = contentLength - offset
 	}
+	// widen the range to whole runes
+	end := uint(tm.runeEnd(int(offset + length)))
+	offset = uint(tm.runeStart(int(offset)))
+	length = end - offset
 
-	tm.redoStack = tm.redoStack[:0]
-
-	state := tm.getCurrentState()
-	resultState := new(State)
-	resultState.pieces = make([]Piece, 0)
-	var bytes uint = 0
-	flag := false
-	for index, piece := range state.pieces {
-		bytes += (uint)(piece.length)
-		if bytes >= offset {
-			i := (int)(offset - (bytes - (uint)(piece.length)))
-			var p1, p2 = new(Piece), new(Piece)
-			if i != 0 {
-				*p1 = Piece{piece.origin, piece.offset, i}
-			}
-			if length >= (uint)(piece.length-i) {
-				offset = bytes
-				length -= (uint)(piece.length - i)
-				if p1.length != 0 {
-					resultState.pieces = append(resultState.pieces, *p1)
-				}
-				flag = true
-				continue
-			} else {
-				if flag {
-					size := (int)((uint)(piece.length) - length)
-					*p2 = Piece{piece.origin, piece.offset + (int)(length), size}
-				} else {
-					size := (int)((uint)(piece.length) - length - offset)
-					*p2 = Piece{piece.origin, piece.offset + (int)(offset) + (int)(length), size}
-				}
-			}
-			if p1.length != 0 {
-				resultState.pieces = append(resultState.pieces, *p1)
-			}
-			if p2.length != 0 {
-				resultState.pieces = append(resultState.pieces, *p2)
-			}
-			if index+1 < len(state.pieces) {
-				resultState.pieces = append(resultState.pieces, state.pieces[index+1:]...)
-			}
-			break
-		} else {
-			offset -= (uint)(piece.length) + 1
-			bytes -= (uint)(piece.length)
-			resultState.pieces = append(resultState.pieces, piece)
-		}
-	}
-	tm.setNewState(*resultState)
+	removed := tm.apply(int(offset), int(length), nil)
+	tm.record(change{offset: int(offset), removed: removed})
 	return tm
 }
 
 func (tm *TextManager) Undo() Editor {
-	if length := len(tm.pieceTable); length > 1 {
-		tm.redoStack = append(tm.redoStack, tm.pieceTable[length-1])
-		tm.pieceTable = tm.pieceTable[:length-1]
+	if length := len(tm.undoStack); length > 0 {
+		c := tm.undoStack[length-1]
+		tm.apply(c.offset, total(c.added), c.removed)
+		tm.undoStack = tm.undoStack[:length-1]
+		tm.redoStack = append(tm.redoStack, c)
 	}
 	return tm
 }
 
 func (tm *TextManager) Redo() Editor {
 	if length := len(tm.redoStack); length > 0 {
-		tm.pieceTable = append(tm.pieceTable, tm.redoStack[length-1])
+		c := tm.redoStack[length-1]
+		tm.apply(c.offset, total(c.removed), c.added)
 		tm.redoStack = tm.redoStack[:length-1]
+		tm.undoStack = append(tm.undoStack, c)
 	}
 	return tm
 }
 
+// apply replaces length bytes at offset with the added pieces and returns the
+// pieces that were taken out.
+func (tm *TextManager) apply(offset, length int, added []Piece) []Piece {
+	left, rest := tm.split(tm.root, offset)
+	middle, right := tm.split(rest, length)
+	var removed []Piece
+	walk(middle, 0, 0, size(middle), func(p Piece, start int) bool {
+		removed = append(removed, p)
+		return true
+	})
+	tm.root = concat(concat(left, build(added)), right)
+	return removed
+}
+
+// record remembers a change for Undo, any undone changes can no longer be
+// redone.
+func (tm *TextManager) record(c change) {
+	clear(tm.redoStack)
+	tm.redoStack = tm.redoStack[:0]
+	if tm.undoLimit == 0 {
+		return
+	}
+	if tm.undoLimit > 0 && len(tm.undoStack) >= tm.undoLimit {
+		clear(tm.undoStack[:1])
+		tm.undoStack = tm.undoStack[1:]
+	}
+	tm.undoStack = append(tm.undoStack, c)
+}
+
+// SetUndoLimit caps how many changes are kept for Undo, a negative limit
+// keeps them all.
+func (tm *TextManager) SetUndoLimit(limit int) {
+	tm.undoLimit = limit
+	if limit >= 0 && len(tm.undoStack) > limit {
+		tm.undoStack = slices.Clone(tm.undoStack[len(tm.undoStack)-limit:])
+	}
+}
+
+// pieceAt returns the piece holding the byte at offset and where it starts.
+func (tm *TextManager) pieceAt(offset int) (Piece, int, bool) {
+	var found Piece
+	start, ok := 0, false
+	walk(tm.root, 0, offset, offset+1, func(p Piece, s int) bool {
+		found, start, ok = p, s, true
+		return false
+	})
+	return found, start, ok
+}
+
+func total(pieces []Piece) int {
+	length := 0
+	for _, p := range pieces {
+		length += p.length
+	}
+	return length
+}
+
 func (tm *TextManager) String() string {
-	i := len(tm.pieceTable) - 1
-	res := []byte{}
-	for _, p := range tm.pieceTable[i].pieces {
-		if p.origin {
-			res = append(res, tm.originBuffer[p.offset:p.offset+p.length]...)
-		} else {
-			res = append(res, tm.addBuffer[p.offset:p.offset+p.length]...)
+	return tm.Substring(0, tm.Len())
+}
+
+// Len returns the number of bytes in the current text.
+func (tm *TextManager) Len() uint {
+	return uint(size(tm.root))
+}
+
+// Substring returns length bytes of the current text starting at offset,
+// without materialising the rest of the document.
+func (tm *TextManager) Substring(offset, length uint) string {
+	res := make([]byte, 0, length)
+	from, to := int(offset), int(offset+length)
+	walk(tm.root, 0, from, to, func(p Piece, start int) bool {
+		buf := tm.bytes(p)
+		res = append(res, buf[max(from-start, 0):min(to-start, p.length)]...)
+		return true
+	})
+	return string(res)
+}
+
+// LineCount returns the number of lines, which is one more than the number of
+// newlines.
+func (tm *TextManager) LineCount() uint {
+	return uint(lines(tm.root)) + 1
+}
+
+// LineStart returns the offset of the first byte of line, or the length of the
+// text when there is no such line.
+func (tm *TextManager) LineStart(line uint) uint {
+	if line == 0 {
+		return 0
+	}
+	root := tm.root
+	if int(line) > lines(root) {
+		return uint(size(root))
+	}
+	return uint(tm.newlineOffset(root, int(line))) + 1
+}
+
+// LineAt returns the line the byte at offset is on.
+func (tm *TextManager) LineAt(offset uint) uint {
+	root := tm.root
+	return uint(tm.newlinesBefore(root, min(int(offset), size(root))))
+}
+
+// RuneCount returns the number of runes in the current text.
+func (tm *TextManager) RuneCount() uint {
+	return uint(runes(tm.root))
+}
+
+// RuneOffset converts a byte offset into a rune offset.
+func (tm *TextManager) RuneOffset(offset uint) uint {
+	root := tm.root
+	return uint(tm.runesBefore(root, tm.runeStart(min(int(offset), size(root)))))
+}
+
+// ByteOffset converts a rune offset into a byte offset.
+func (tm *TextManager) ByteOffset(offset uint) uint {
+	return uint(tm.runeOffset(tm.root, int(offset)))
+}
+
+// Position converts a byte offset into a line and a column counted in runes.
+func (tm *TextManager) Position(offset uint) (line, column uint) {
+	line = tm.LineAt(offset)
+	return line, tm.RuneOffset(offset) - tm.RuneOffset(tm.LineStart(line))
+}
+
+// Offset converts a line and a column counted in runes into a byte offset,
+// a column past the end of the line is clamped to the end of the line.
+func (tm *TextManager) Offset(line, column uint) uint {
+	start := tm.LineStart(line)
+	end := tm.Len()
+	if line+1 < tm.LineCount() {
+		end = tm.LineStart(line+1) - 1
+	}
+	return min(tm.ByteOffset(tm.RuneOffset(start)+column), end)
+}
+
+// InsertRunes inserts text in front of the rune at offset.
+func (tm *TextManager) InsertRunes(offset uint, text string) Editor {
+	return tm.Insert(tm.ByteOffset(offset), text)
+}
+
+// DeleteRunes deletes count runes starting with the rune at offset.
+func (tm *TextManager) DeleteRunes(offset, count uint) Editor {
+	from := tm.ByteOffset(offset)
+	return tm.Delete(from, tm.ByteOffset(offset+count)-from)
+}
+
+// InsertAt inserts text at a line and a column counted in runes.
+func (tm *TextManager) InsertAt(line, column uint, text string) Editor {
+	return tm.Insert(tm.Offset(line, column), text)
+}
+
+// DeleteAt deletes count runes starting at a line and a column counted in
+// runes, newlines included.
+func (tm *TextManager) DeleteAt(line, column, count uint) Editor {
+	return tm.DeleteRunes(tm.RuneOffset(tm.Offset(line, column)), count)
+}
+
+// piece makes a piece for a slice of one of the buffers.
+func (tm *TextManager) piece(origin bool, offset, length int) Piece {
+	p := Piece{origin: origin, offset: offset, length: length}
+	buf := tm.bytes(p)
+	p.lines = bytes.Count(buf, []byte{'\n'})
+	p.runes = utf8.RuneCount(buf)
+	return p
+}
+
+// pieces cuts a slice of a buffer into pieces no longer than maxPieceLength,
+// never cutting through a rune.
+func (tm *TextManager) pieces(origin bool, offset, length int) []Piece {
+	var res []Piece
+	buf := tm.originBuffer
+	if !origin {
+		buf = tm.addBuffer
+	}
+	for length > 0 {
+		n := min(length, maxPieceLength)
+		for back := 0; n < length && back < utf8.UTFMax && !utf8.RuneStart(buf[offset+n]); back++ {
+			n--
 		}
+		res = append(res, tm.piece(origin, offset, n))
+		offset += n
+		length -= n
 	}
-	return string(res)
+	return res
+}
+
+// runeStart moves offset back to the start of the rune it points into.
+func (tm *TextManager) runeStart(offset int) int {
+	from := max(offset-utf8.UTFMax+1, 0)
+	buf := tm.Substring(uint(from), uint(offset-from+utf8.UTFMax))
+	for i := min(offset-from, len(buf)-1); i >= 0 && from+i > offset-utf8.UTFMax; i-- {
+		if utf8.RuneStart(buf[i]) {
+			if _, width := utf8.DecodeRuneInString(buf[i:]); from+i+width > offset {
+				return from + i
+			}
+			break
+		}
+	}
+	return offset
+}
+
+// runeEnd moves offset forward to the end of the rune it points into.
+func (tm *TextManager) runeEnd(offset int) int {
+	start := tm.runeStart(offset)
+	if start == offset {
+		return offset
+	}
+	_, width := utf8.DecodeRuneInString(tm.Substring(uint(start), utf8.UTFMax))
+	return start + width
+}
+
+// splitPiece cuts a piece in two at i.
+func (tm *TextManager) splitPiece(p Piece, i int) (Piece, Piece) {
+	return tm.piece(p.origin, p.offset, i), tm.piece(p.origin, p.offset+i, p.length-i)
+}
+
+func (tm *TextManager) bytes(p Piece) []byte {
+	if p.origin {
+		return tm.originBuffer[p.offset : p.offset+p.length]
+	}
+	return tm.addBuffer[p.offset : p.offset+p.length]
 }
 
 type Editor interface {
@@ -165,21 +323,76 @@ type Editor interface {
 	// String returns complete representation of what a file looks
 	// like after all manipulations.
 	String() string
+
+	// Len returns the length of the text in bytes.
+	Len() uint
+
+	// Substring returns length bytes starting from offset.
+	Substring(offset, length uint) string
+
+	// LineCount returns the number of lines, an empty text has one.
+	LineCount() uint
+
+	// LineStart returns the offset the given line starts at.
+	LineStart(line uint) uint
+
+	// LineAt returns the line holding the byte at offset.
+	LineAt(offset uint) uint
+
+	// RuneCount returns the length of the text in runes.
+	RuneCount() uint
+
+	// RuneOffset converts a byte offset into a rune offset.
+	RuneOffset(offset uint) uint
+
+	// ByteOffset converts a rune offset into a byte offset.
+	ByteOffset(offset uint) uint
+
+	// Position converts a byte offset into a line and rune column.
+	Position(offset uint) (line, column uint)
+
+	// Offset converts a line and rune column into a byte offset.
+	Offset(line, column uint) uint
+
+	// InsertRunes inserts text at a rune offset.
+	InsertRunes(offset uint, text string) Editor
+
+	// DeleteRunes deletes count runes from a rune offset.
+	DeleteRunes(offset, count uint) Editor
+
+	// InsertAt inserts text at a line and rune column.
+	InsertAt(line, column uint, text string) Editor
+
+	// DeleteAt deletes count runes from a line and rune column.
+	DeleteAt(line, column, count uint) Editor
+
+	// SetUndoLimit caps the number of changes kept for Undo, negative for
+	// no limit.
+	SetUndoLimit(limit int)
 }
 
 type Piece struct {
 	origin bool
 	offset int
 	length int
+	lines  int // newlines in the piece
+	runes  int // runes in the piece
 }
 
-type State struct {
-	pieces []Piece
+// change records what a single edit did: at offset the removed pieces were
+// replaced by the added ones.  The pieces still point into the buffers, so
+// undoing or redoing an edit never copies any text.
+type change struct {
+	offset  int
+	removed []Piece
+	added   []Piece
 }
 
 type TextManager struct {
 	originBuffer []byte
 	addBuffer    []byte
-	pieceTable   []State
-	redoStack    []State
+	root         *node
+	undoStack    []change
+	redoStack    []change
+	undoLimit    int // changes kept for Undo, negative for no limit
 }
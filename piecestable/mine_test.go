@@ -1,6 +1,12 @@
 package piecestable
 
-import "testing"
+import (
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
 
 func TestSample(t *testing.T) {
 	t.Run("origin", func(t *testing.T) {
@@ -22,6 +28,40 @@ func TestSample(t *testing.T) {
 		f := NewEditor("foobar")
 		compare(t, "far", f.Delete(1, 3).String())
 	})
+
+	t.Run("delete across pieces", func(t *testing.T) {
+		f := NewEditor("foobar")
+		f.Insert(3, "baz")
+		compare(t, "foobazbar", f.String())
+		compare(t, "foar", f.Delete(2, 5).String())
+	})
+
+	t.Run("delete inside inserted piece", func(t *testing.T) {
+		f := NewEditor("foo")
+		f.Insert(3, "bar")
+		compare(t, "foobr", f.Delete(4, 1).String())
+	})
+
+	t.Run("undo keeps older states intact", func(t *testing.T) {
+		f := NewEditor("foobar")
+		f.Insert(6, "1")
+		f.Insert(7, "2")
+		f.Insert(3, "-")
+		compare(t, "foo-bar12", f.String())
+		compare(t, "foobar12", f.Undo().String())
+		compare(t, "foobar1", f.Undo().String())
+		compare(t, "foobar12", f.Redo().String())
+	})
+
+	t.Run("substring", func(t *testing.T) {
+		f := NewEditor("foobar")
+		f.Insert(3, "baz")
+		compare(t, "oba", f.Substring(2, 3))
+		compare(t, "zba", f.Substring(5, 3))
+		if f.Len() != 9 {
+			t.Errorf("Expect length 9; got %d", f.Len())
+		}
+	})
 }
 
 func compare(t *testing.T, exp, got string) {
@@ -29,3 +69,212 @@ func compare(t *testing.T, exp, got string) {
 		t.Errorf("Expect: %q; got %q", exp, got)
 	}
 }
+
+func TestLines(t *testing.T) {
+	f := NewEditor("one\ntwo\n")
+	f.Insert(4, "1.5\n")
+	compare(t, "one\n1.5\ntwo\n", f.String())
+
+	if got := f.LineCount(); got != 4 {
+		t.Errorf("Expect 4 lines; got %d", got)
+	}
+	for line, exp := range []uint{0, 4, 8, 12} {
+		if got := f.LineStart(uint(line)); got != exp {
+			t.Errorf("Expect line %d to start at %d; got %d", line, exp, got)
+		}
+	}
+	for offset, exp := range []uint{0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3} {
+		if got := f.LineAt(uint(offset)); got != exp {
+			t.Errorf("Expect offset %d on line %d; got %d", offset, exp, got)
+		}
+	}
+}
+
+func TestRandomEdits(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	model := strings.Repeat("package main\n\nfunc main() {\n}\n", 500)
+	f := NewEditor(model)
+	tm := f.(*TextManager)
+
+	for i := 0; i < 2000; i++ {
+		offset := uint(rnd.Intn(len(model) + 1))
+		if rnd.Intn(3) == 0 {
+			length := uint(rnd.Intn(20))
+			f.Delete(offset, length)
+			end := min(int(offset+length), len(model))
+			if int(offset) < len(model) {
+				model = model[:offset] + model[end:]
+			}
+		} else {
+			text := []string{"x", "\n", "foo\nbar", strings.Repeat("y", 5000)}[rnd.Intn(4)]
+			f.Insert(offset, text)
+			model = model[:offset] + text + model[offset:]
+		}
+	}
+
+	compare(t, model, f.String())
+	if got := f.LineCount(); got != uint(strings.Count(model, "\n")+1) {
+		t.Errorf("Expect %d lines; got %d", strings.Count(model, "\n")+1, got)
+	}
+	for line, start := range lineStarts(model) {
+		if got := f.LineStart(uint(line)); got != uint(start) {
+			t.Fatalf("Expect line %d to start at %d; got %d", line, start, got)
+		}
+		if got := f.LineAt(uint(start)); got != uint(line) {
+			t.Fatalf("Expect offset %d on line %d; got %d", start, line, got)
+		}
+	}
+	checkBalanced(t, tm.root)
+
+	// every edit can be undone and redone again
+	final := model
+	for range tm.undoStack {
+		f.Undo()
+	}
+	compare(t, strings.Repeat("package main\n\nfunc main() {\n}\n", 500), f.String())
+	for range tm.redoStack {
+		f.Redo()
+	}
+	compare(t, final, f.String())
+	checkBalanced(t, tm.root)
+}
+
+func lineStarts(s string) []int {
+	starts := []int{0}
+	for i, c := range s {
+		if c == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+func checkBalanced(t *testing.T, n *node) {
+	if n == nil {
+		return
+	}
+	if bf := balanceFactor(n); bf > 1 || bf < -1 {
+		t.Fatalf("unbalanced node: %d", bf)
+	}
+	if n.piece.length > maxPieceLength {
+		t.Fatalf("piece too long: %d", n.piece.length)
+	}
+	checkBalanced(t, n.left)
+	checkBalanced(t, n.right)
+}
+
+func BenchmarkTypingInLargeFile(b *testing.B) {
+	f := NewEditor(strings.Repeat("\tfmt.Println(\"hello, world\")\n", 150000))
+	middle := f.LineStart(f.LineCount() / 2)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Insert(middle+uint(i), "x")
+		f.LineAt(middle)
+	}
+}
+
+func TestRunes(t *testing.T) {
+	t.Run("insert never splits a rune", func(t *testing.T) {
+		f := NewEditor("a世界b")
+		// byte 2 is in the middle of 世
+		compare(t, "ax世界b", f.Insert(2, "x").String())
+		compare(t, "ax世y界b", f.Insert(7, "y").String())
+	})
+
+	t.Run("delete removes whole runes", func(t *testing.T) {
+		f := NewEditor("a世界b")
+		compare(t, "a界b", f.Delete(2, 1).String())
+		f = NewEditor("🎉🎉")
+		compare(t, "🎉", f.Delete(3, 1).String())
+	})
+
+	t.Run("rune offsets", func(t *testing.T) {
+		f := NewEditor("héllo 世界 🎉!")
+		if got := f.RuneCount(); got != 11 {
+			t.Errorf("Expect 11 runes; got %d", got)
+		}
+		for runeOffset, byteOffset := range []uint{0, 1, 3, 4, 5, 6, 7, 10, 13, 14, 18, 19} {
+			if got := f.ByteOffset(uint(runeOffset)); got != byteOffset {
+				t.Errorf("Expect rune %d at byte %d; got %d", runeOffset, byteOffset, got)
+			}
+			if got := f.RuneOffset(byteOffset); got != uint(runeOffset) {
+				t.Errorf("Expect byte %d to be rune %d; got %d", byteOffset, runeOffset, got)
+			}
+		}
+		// the middle of a rune counts as the rune itself
+		if got := f.RuneOffset(8); got != 6 {
+			t.Errorf("Expect byte 8 to be rune 6; got %d", got)
+		}
+	})
+
+	t.Run("rune edits", func(t *testing.T) {
+		f := NewEditor("世界")
+		compare(t, "世🎉界", f.InsertRunes(1, "🎉").String())
+		compare(t, "世界", f.DeleteRunes(1, 1).String())
+	})
+
+	t.Run("line and column", func(t *testing.T) {
+		f := NewEditor("// 日本語\nvar 名前 = \"🎉\"\n")
+		line, column := f.Position(f.ByteOffset(16))
+		if line != 1 || column != 9 {
+			t.Errorf("Expect 1:9; got %d:%d", line, column)
+		}
+		if got := f.Offset(1, 9); got != f.ByteOffset(16) {
+			t.Errorf("Expect offset %d; got %d", f.ByteOffset(16), got)
+		}
+		if got := f.Offset(0, 100); got != 12 {
+			t.Errorf("Expect a long column to clamp to 12; got %d", got)
+		}
+		compare(t, "// 日本語\nvar 名前前 = \"🎉\"\n", f.InsertAt(1, 6, "前").String())
+		compare(t, "// 日本語\nvar 名前前 = \"\"\n", f.DeleteAt(1, 11, 1).String())
+		compare(t, "// 日本語var 名前前 = \"\"\n", f.DeleteAt(0, 6, 1).String())
+	})
+
+	t.Run("pieces are cut on rune boundaries", func(t *testing.T) {
+		text := "a" + strings.Repeat("世", maxPieceLength)
+		f := NewEditor(text)
+		tm := f.(*TextManager)
+		walk(tm.root, 0, 0, len(text), func(p Piece, start int) bool {
+			if !utf8.Valid(tm.bytes(p)) {
+				t.Errorf("piece at %d is not valid UTF-8", start)
+			}
+			return true
+		})
+		if got := f.RuneCount(); got != maxPieceLength+1 {
+			t.Errorf("Expect %d runes; got %d", maxPieceLength+1, got)
+		}
+	})
+}
+
+// BenchmarkUndoMemory types 100k keystrokes into a 4MB file and reports how
+// much memory the editor holds on to afterwards, most of which is undo history.
+func BenchmarkUndoMemory(b *testing.B) {
+	text := strings.Repeat("\tfmt.Println(\"hello, world\")\n", 150000)
+	var before, after runtime.MemStats
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		f := NewEditor(text)
+		rnd := rand.New(rand.NewSource(1))
+		position := f.Len() / 2
+		for k := 0; k < 100000; k++ {
+			if rnd.Intn(50) == 0 {
+				// jump somewhere else, like moving the cursor
+				position = uint(rnd.Intn(int(f.Len())))
+			}
+			if rnd.Intn(10) == 0 && position > 0 {
+				position--
+				f.Delete(position, 1)
+			} else {
+				f.Insert(position, "x")
+				position++
+			}
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "MB-retained")
+		runtime.KeepAlive(f)
+	}
+}
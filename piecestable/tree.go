@@ -0,0 +1,280 @@
+package piecestable
+
+// The pieces of the text are kept in an AVL tree ordered by their position in
+// the text.  Every node caches the byte length, newline count and rune count of
+// its subtree, so offsets, lines and runes can be found in O(log n).  Nodes are
+// never modified once built, an edit copies the path it touches and shares the
+// rest.
+
+import (
+	"bytes"
+	"unicode/utf8"
+)
+
+// maxPieceLength caps the size of a piece so scanning inside one piece, to find
+// a newline say, takes bounded time no matter how large the file is.
+const maxPieceLength = 4096
+
+type node struct {
+	piece  Piece
+	left   *node
+	right  *node
+	height int
+	length int // bytes in this subtree
+	lines  int // newlines in this subtree
+	runes  int // runes in this subtree
+}
+
+func newNode(left *node, p Piece, right *node) *node {
+	return &node{
+		piece:  p,
+		left:   left,
+		right:  right,
+		height: max(height(left), height(right)) + 1,
+		length: size(left) + p.length + size(right),
+		lines:  lines(left) + p.lines + lines(right),
+		runes:  runes(left) + p.runes + runes(right),
+	}
+}
+
+func height(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func size(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.length
+}
+
+func lines(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.lines
+}
+
+func runes(n *node) int {
+	if n == nil {
+		return 0
+	}
+	return n.runes
+}
+
+func balanceFactor(n *node) int {
+	return height(n.left) - height(n.right)
+}
+
+func rotateRight(n *node) *node {
+	l := n.left
+	return newNode(l.left, l.piece, newNode(l.right, n.piece, n.right))
+}
+
+func rotateLeft(n *node) *node {
+	r := n.right
+	return newNode(newNode(n.left, n.piece, r.left), r.piece, r.right)
+}
+
+// rebalance restores the AVL invariant of a node whose children differ in
+// height by at most two.
+func rebalance(n *node) *node {
+	switch bf := balanceFactor(n); {
+	case bf > 1:
+		if balanceFactor(n.left) < 0 {
+			n = newNode(rotateLeft(n.left), n.piece, n.right)
+		}
+		return rotateRight(n)
+	case bf < -1:
+		if balanceFactor(n.right) > 0 {
+			n = newNode(n.left, n.piece, rotateRight(n.right))
+		}
+		return rotateLeft(n)
+	}
+	return n
+}
+
+// join builds the tree holding everything in left, then p, then everything in
+// right, whatever the heights of left and right.
+func join(left *node, p Piece, right *node) *node {
+	switch {
+	case height(left) > height(right)+1:
+		return rebalance(newNode(left.left, left.piece, join(left.right, p, right)))
+	case height(right) > height(left)+1:
+		return rebalance(newNode(join(left, p, right.left), right.piece, right.right))
+	}
+	return newNode(left, p, right)
+}
+
+// concat appends right to left.
+func concat(left, right *node) *node {
+	if left == nil {
+		return right
+	}
+	if right == nil {
+		return left
+	}
+	p, rest := splitFirst(right)
+	return join(left, p, rest)
+}
+
+// splitFirst removes the first piece of a non-empty tree.
+func splitFirst(n *node) (Piece, *node) {
+	if n.left == nil {
+		return n.piece, n.right
+	}
+	p, rest := splitFirst(n.left)
+	return p, join(rest, n.piece, n.right)
+}
+
+// splitLast removes the last piece of a non-empty tree.
+func splitLast(n *node) (*node, Piece) {
+	if n.right == nil {
+		return n.left, n.piece
+	}
+	rest, p := splitLast(n.right)
+	return join(n.left, n.piece, rest), p
+}
+
+// split cuts the tree at a byte offset, splitting the piece the offset falls in.
+func (tm *TextManager) split(n *node, offset int) (*node, *node) {
+	if n == nil {
+		return nil, nil
+	}
+	leftSize := size(n.left)
+	switch {
+	case offset < leftSize:
+		l, r := tm.split(n.left, offset)
+		return l, join(r, n.piece, n.right)
+	case offset == leftSize:
+		return n.left, join(nil, n.piece, n.right)
+	case offset >= leftSize+n.piece.length:
+		l, r := tm.split(n.right, offset-leftSize-n.piece.length)
+		return join(n.left, n.piece, l), r
+	}
+	head, tail := tm.splitPiece(n.piece, offset-leftSize)
+	return join(n.left, head, nil), join(nil, tail, n.right)
+}
+
+// build returns a balanced tree holding pieces in order.
+func build(pieces []Piece) *node {
+	if len(pieces) == 0 {
+		return nil
+	}
+	mid := len(pieces) / 2
+	return newNode(build(pieces[:mid]), pieces[mid], build(pieces[mid+1:]))
+}
+
+// walk calls fn for every piece overlapping [from, to), with the offset the
+// piece starts at, until fn returns false.
+func walk(n *node, start, from, to int, fn func(p Piece, start int) bool) bool {
+	if n == nil || from >= start+n.length || to <= start {
+		return true
+	}
+	if !walk(n.left, start, from, to, fn) {
+		return false
+	}
+	pieceStart := start + size(n.left)
+	if from < pieceStart+n.piece.length && to > pieceStart {
+		if !fn(n.piece, pieceStart) {
+			return false
+		}
+	}
+	return walk(n.right, pieceStart+n.piece.length, from, to, fn)
+}
+
+// newlineOffset returns the offset of the k-th (counting from 1) newline.
+func (tm *TextManager) newlineOffset(n *node, k int) int {
+	offset := 0
+	for n != nil {
+		if k <= lines(n.left) {
+			n = n.left
+			continue
+		}
+		k -= lines(n.left)
+		offset += size(n.left)
+		if k <= n.piece.lines {
+			buf := tm.bytes(n.piece)
+			for i, b := range buf {
+				if b == '\n' {
+					if k--; k == 0 {
+						return offset + i
+					}
+				}
+			}
+		}
+		k -= n.piece.lines
+		offset += n.piece.length
+		n = n.right
+	}
+	return offset
+}
+
+// newlinesBefore counts the newlines in front of offset.
+func (tm *TextManager) newlinesBefore(n *node, offset int) int {
+	count := 0
+	for n != nil {
+		if offset <= size(n.left) {
+			n = n.left
+			continue
+		}
+		count += lines(n.left)
+		offset -= size(n.left)
+		if offset <= n.piece.length {
+			return count + bytes.Count(tm.bytes(n.piece)[:offset], []byte{'\n'})
+		}
+		count += n.piece.lines
+		offset -= n.piece.length
+		n = n.right
+	}
+	return count
+}
+
+// runesBefore counts the runes in front of offset.
+func (tm *TextManager) runesBefore(n *node, offset int) int {
+	count := 0
+	for n != nil {
+		if offset <= size(n.left) {
+			n = n.left
+			continue
+		}
+		count += runes(n.left)
+		offset -= size(n.left)
+		if offset <= n.piece.length {
+			return count + utf8.RuneCount(tm.bytes(n.piece)[:offset])
+		}
+		count += n.piece.runes
+		offset -= n.piece.length
+		n = n.right
+	}
+	return count
+}
+
+// runeOffset returns the byte offset of the k-th (counting from 0) rune.
+func (tm *TextManager) runeOffset(n *node, k int) int {
+	offset := 0
+	for n != nil {
+		if k < runes(n.left) {
+			n = n.left
+			continue
+		}
+		k -= runes(n.left)
+		offset += size(n.left)
+		if k < n.piece.runes {
+			buf := tm.bytes(n.piece)
+			i := 0
+			for ; k > 0; k-- {
+				_, width := utf8.DecodeRune(buf[i:])
+				i += width
+			}
+			return offset + i
+		}
+		k -= n.piece.runes
+		offset += n.piece.length
+		n = n.right
+	}
+	return offset
+}
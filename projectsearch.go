@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+// projectSearch looks for a text in every loaded file on a goroutine of its
+// own, so the key loop keeps going while it runs.  The editors can't be read
+// from another goroutine, so the search asks the key loop for a copy of the
+// text of one file at a time, with a fileTextRequest, and keys are handled in
+// between.  Results are added file by file and the screen is woken up to show
+// them.
+type projectSearch struct {
+	mu      sync.Mutex
+	results []fileResults
+	files   int // files searched so far
+	total   int
+	done    bool
+
+	cancelled atomic.Bool
+}
+
+type fileResults struct {
+	path    string
+	matches []projectMatch
+}
+
+type projectMatch struct {
+	editors.Match
+	text        string // what matched
+	replacement string
+	preview     string // the line
+	replaced    string // the line with just this match replaced
+}
+
+// startProjectSearch searches the loaded files whose path matches one of the
+// include globs, or any file when there are none, and none of the exclude
+// globs.  Globs are separated by commas or spaces, one holding a '/' is matched
+// against the whole path and one without against the file name.  What would
+// replace every match is worked out along the way.
+func startProjectSearch(text, replacement string, options editors.SearchOptions, include, exclude string) (*projectSearch, error) {
+	search, err := editors.NewSearch(text, options)
+	if err != nil {
+		return nil, err
+	}
+	includes, err := parseGlobs(include)
+	if err != nil {
+		return nil, err
+	}
+	excludes, err := parseGlobs(exclude)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for path := range files {
+		if (len(includes) == 0 || matchGlobs(includes, path)) && !matchGlobs(excludes, path) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+
+	ps := &projectSearch{total: len(paths)}
+	go func() {
+		defer screen.PostEvent(tcell.NewEventInterrupt(nil))
+		for _, path := range paths {
+			lines, ok := ps.fileText(path)
+			if !ok {
+				return
+			}
+			var found []projectMatch
+			for l, line := range lines {
+				replacements := search.Replacements(line, replacement)
+				for j, m := range search.Line(line) {
+					replaced := slices.Concat(line[:m[0]], []rune(replacements[j]), line[m[1]:])
+					found = append(found, projectMatch{
+						Match:       editors.Match{Start: editors.Position{Line: l, Column: m[0]}, End: editors.Position{Line: l, Column: m[1]}},
+						text:        string(line[m[0]:m[1]]),
+						replacement: replacements[j],
+						preview:     preview(line),
+						replaced:    preview(replaced),
+					})
+				}
+			}
+			ps.mu.Lock()
+			ps.files++
+			if len(found) > 0 {
+				ps.results = append(ps.results, fileResults{path, found})
+			}
+			ps.mu.Unlock()
+			if len(found) > 0 {
+				screen.PostEvent(tcell.NewEventInterrupt(nil))
+			}
+		}
+		ps.mu.Lock()
+		ps.done = true
+		ps.mu.Unlock()
+	}()
+	return ps, nil
+}
+
+// fileTextRequest asks the key loop for a copy of the lines of a loaded file.
+type fileTextRequest struct {
+	path  string
+	reply chan [][]rune
+}
+
+// answer is called on the key loop, a file closed in the meantime has no lines.
+func (req fileTextRequest) answer() {
+	var lines [][]rune
+	if f := files[req.path]; f != nil {
+		lines = make([][]rune, f.Length())
+		for l := range lines {
+			line, _ := f.GetLine(l)
+			lines[l] = slices.Clone(line)
+		}
+	}
+	req.reply <- lines
+}
+
+// fileText gets the lines of a file from the key loop, it reports false when
+// the search was cancelled first.
+func (ps *projectSearch) fileText(path string) ([][]rune, bool) {
+	req := fileTextRequest{path, make(chan [][]rune, 1)}
+	// the queue is full when keys come faster than they are handled
+	for screen.PostEvent(tcell.NewEventInterrupt(req)) != nil {
+		if ps.cancelled.Load() {
+			return nil, false
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return <-req.reply, !ps.cancelled.Load()
+}
+
+func (ps *projectSearch) cancel() {
+	ps.cancelled.Store(true)
+}
+
+// snapshot returns the results so far, how many files were searched and
+// whether the search is over.
+func (ps *projectSearch) snapshot() ([]fileResults, int, bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return slices.Clone(ps.results), ps.files, ps.done
+}
+
+func parseGlobs(globs string) ([]string, error) {
+	rtn := strings.FieldsFunc(globs, func(r rune) bool { return r == ',' || r == ' ' })
+	for _, glob := range rtn {
+		if _, err := filepath.Match(glob, ""); err != nil {
+			return nil, fmt.Errorf("bad glob %q: %v", glob, err)
+		}
+	}
+	return rtn, nil
+}
+
+func matchGlobs(globs []string, path string) bool {
+	path = filepath.ToSlash(path)
+	for _, glob := range globs {
+		name := path
+		if !strings.Contains(glob, "/") {
+			name = filepath.Base(path)
+		}
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// preview is a line as it is shown in a list, tabs drawn as a space and cut
+// short when it is long.
+func preview(line []rune) string {
+	text := strings.TrimSpace(strings.ReplaceAll(string(line), "\t", " "))
+	if r := []rune(text); len(r) > 200 {
+		text = string(r[:200])
+	}
+	return text
+}
+
+// projectSearchPanel has the text to find, what to replace it with when
+// replacing, and the globs of the files to look in at the top, and the results
+// grouped by file below.  Up and Down move through both, Enter in a field
+// starts the search and on a result jumps to it.  When replacing every match
+// shows the line before and after, Space rejects or accepts it, or all the
+// matches of a file on its name, and Ctrl+R replaces the accepted ones.
+type projectSearchPanel struct {
+	fields    [4][]rune // text, replacement, include and exclude globs
+	options   editors.SearchOptions
+	replacing bool
+	search    *projectSearch
+	err       error
+	rejected  map[hunk]bool
+	selected  int // a row
+
+	rows    []projectRow // what was drawn last
+	results []fileResults
+}
+
+// hunk is a match by the file it is in and its index among the matches there.
+type hunk struct {
+	path  string
+	index int
+}
+
+type projectRow struct {
+	text   string
+	field  int // -1 if not a field
+	result int // -1 if not a result, the index in results otherwise
+	match  int // -1 for the name of the file, the index in its matches otherwise
+}
+
+const (
+	FIND_FIELD = iota
+	REPLACE_FIELD
+	INCLUDE_FIELD
+	EXCLUDE_FIELD
+)
+
+var projectSearchFields = [4]string{"Find", "Replace", "Include", "Exclude"}
+
+func openProjectSearchPanel() {
+	activePanel = &projectSearchPanel{}
+}
+
+func (p *projectSearchPanel) draw() {
+	p.buildRows()
+	p.selected = min(p.selected, len(p.rows)-1)
+	text := make([]string, len(p.rows))
+	for i, row := range p.rows {
+		text[i] = row.text
+	}
+	title := "Find in files: Enter search/jump  Up/Down move  Esc close"
+	if p.replacing {
+		title = "Replace in files: Enter search/jump  Space reject/accept  Ctrl+R replace  Esc close"
+	}
+	drawList(title, text, p.selected)
+}
+
+// buildRows lays out the fields and the results found so far.
+func (p *projectSearchPanel) buildRows() {
+	toggle := func(on bool) string {
+		if on {
+			return "x"
+		}
+		return " "
+	}
+	p.rows = p.rows[:0]
+	for i, name := range projectSearchFields {
+		if i != REPLACE_FIELD || p.replacing {
+			p.rows = append(p.rows, projectRow{fmt.Sprintf("%-8s %s", name+":", string(p.fields[i])), i, -1, -1})
+		}
+	}
+	status := ""
+	switch {
+	case p.err != nil:
+		status = p.err.Error()
+	case p.search != nil:
+		var searched int
+		var done bool
+		p.results, searched, done = p.search.snapshot()
+		count := 0
+		for _, r := range p.results {
+			count += len(r.matches)
+		}
+		status = fmt.Sprintf("%d matches in %d files, searched %d of %d", count, len(p.results), searched, p.search.total)
+		if !done {
+			status += "..."
+		}
+	}
+	p.rows = append(p.rows, projectRow{fmt.Sprintf("[%s] case Alt+C  [%s] word Alt+W  [%s] regex Alt+R  [%s] replace Alt+P   %s",
+		toggle(p.options.CaseSensitive), toggle(p.options.WholeWord), toggle(p.options.Regexp), toggle(p.replacing), status), -1, -1, -1})
+
+	for i, r := range p.results {
+		p.rows = append(p.rows, projectRow{fmt.Sprintf("%s (%d)", r.path, len(r.matches)), -1, i, -1})
+		for j, m := range r.matches {
+			if !p.replacing {
+				p.rows = append(p.rows, projectRow{fmt.Sprintf("  %5d: %s", m.Start.Line+1, m.preview), -1, i, j})
+				continue
+			}
+			p.rows = append(p.rows,
+				projectRow{fmt.Sprintf("  [%s] %5d - %s", toggle(!p.rejected[hunk{r.path, j}]), m.Start.Line+1, m.preview), -1, i, j},
+				projectRow{fmt.Sprintf("            + %s", m.replaced), -1, -1, -1})
+		}
+	}
+}
+
+func (p *projectSearchPanel) handleKey(ev *tcell.EventKey) bool {
+	alt := ev.Modifiers()&tcell.ModAlt != 0
+	if len(p.rows) == 0 {
+		p.buildRows()
+	}
+	row := p.rows[p.selected]
+	switch {
+	case ev.Key() == tcell.KeyEscape:
+		p.stop()
+		return false
+	case ev.Key() == tcell.KeyUp:
+		p.move(-1)
+	case ev.Key() == tcell.KeyDown:
+		p.move(1)
+	case ev.Key() == tcell.KeyTab:
+		// to the next field
+		p.selected = (p.selected + 1) % len(p.rows)
+		for p.rows[p.selected].field < 0 {
+			p.selected = (p.selected + 1) % len(p.rows)
+		}
+	case ev.Key() == tcell.KeyEnter && row.field >= 0:
+		p.start()
+	case ev.Key() == tcell.KeyEnter && row.result >= 0:
+		p.stop()
+		r := p.results[row.result]
+		jumpTo(r.path, r.matches[max(row.match, 0)].Match)
+		return false
+	case ev.Key() == tcell.KeyCtrlR && p.replacing && p.search != nil:
+		if _, _, done := p.search.snapshot(); !done {
+			logf("Search still running, nothing replaced")
+			break
+		}
+		replaceInFiles(p.results, p.rejected)
+		return false
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'c' || ev.Rune() == 'C'):
+		p.options.CaseSensitive = !p.options.CaseSensitive
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'w' || ev.Rune() == 'W'):
+		p.options.WholeWord = !p.options.WholeWord
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'r' || ev.Rune() == 'R'):
+		p.options.Regexp = !p.options.Regexp
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'p' || ev.Rune() == 'P'):
+		p.replacing = !p.replacing
+		p.selected = 0
+	case ev.Key() == tcell.KeyRune && ev.Rune() == ' ' && row.result >= 0 && p.replacing:
+		p.toggle(row)
+	case (ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2) && row.field >= 0:
+		if text := p.fields[row.field]; len(text) > 0 {
+			p.fields[row.field] = text[:len(text)-1]
+		}
+	case ev.Key() == tcell.KeyRune && row.field >= 0:
+		p.fields[row.field] = append(p.fields[row.field], ev.Rune())
+	}
+	return true
+}
+
+// move selects the next row, up or down, that is a field or a result.
+func (p *projectSearchPanel) move(step int) {
+	for i := p.selected + step; i >= 0 && i < len(p.rows); i += step {
+		if p.rows[i].field >= 0 || p.rows[i].result >= 0 {
+			p.selected = i
+			return
+		}
+	}
+}
+
+// toggle rejects a match that was accepted and the other way round, on the
+// name of a file it does so for all its matches.
+func (p *projectSearchPanel) toggle(row projectRow) {
+	r := p.results[row.result]
+	if row.match >= 0 {
+		h := hunk{r.path, row.match}
+		p.rejected[h] = !p.rejected[h]
+		return
+	}
+	// all of them rejected unless they already were
+	reject := false
+	for i := range r.matches {
+		reject = reject || !p.rejected[hunk{r.path, i}]
+	}
+	for i := range r.matches {
+		p.rejected[hunk{r.path, i}] = reject
+	}
+}
+
+// start replaces the running search, if any, with a new one.
+func (p *projectSearchPanel) start() {
+	p.stop()
+	p.search, p.err, p.results = nil, nil, nil
+	p.rejected = make(map[hunk]bool)
+	if len(p.fields[FIND_FIELD]) == 0 {
+		return
+	}
+	p.search, p.err = startProjectSearch(string(p.fields[FIND_FIELD]), string(p.fields[REPLACE_FIELD]), p.options,
+		string(p.fields[INCLUDE_FIELD]), string(p.fields[EXCLUDE_FIELD]))
+}
+
+func (p *projectSearchPanel) stop() {
+	if p.search != nil {
+		p.search.cancel()
+	}
+}
+
+// jumpTo shows a file with a match selected.  The file may have changed since
+// it was searched, so the match is kept inside the text.
+func jumpTo(path string, m editors.Match) {
+	if editorArea == nil {
+		return
+	}
+	showFile(path)
+	f := editorArea.content
+	clamp := func(pos editors.Position) editors.Position {
+		if pos.Line >= f.Length() {
+			return editors.Position{Line: f.Length()}
+		}
+		line, _ := f.GetLine(pos.Line)
+		return editors.Position{Line: pos.Line, Column: min(pos.Column, len(line))}
+	}
+	cursors.Set([]editors.Selection{{Head: clamp(m.End), Tail: clamp(m.Start)}})
+	syncCursor()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGlobs(t *testing.T) {
+	globs, err := parseGlobs("*.go, cmd/*  *_test.go,")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"*.go", "cmd/*", "*_test.go"}, globs)
+
+	globs, err = parseGlobs("")
+	assert.NoError(t, err)
+	assert.Empty(t, globs)
+
+	_, err = parseGlobs("*.go [a-")
+	assert.EqualError(t, err, `bad glob "[a-": syntax error in pattern`)
+}
+
+func TestMatchGlobs(t *testing.T) {
+	for _, test := range []struct {
+		glob, path string
+		want       bool
+	}{
+		// a bare name is matched against the file name, in any directory
+		{"*.go", "main.go", true},
+		{"*.go", "/src/goedit/editors/rope.go", true},
+		{"*.go", "/src/goedit/go.mod", false},
+		{"rope.go", "/src/goedit/editors/rope.go", true},
+		{"editors", "/src/goedit/editors/rope.go", false},
+		// one with a '/' against the whole path, '*' stops at a '/'
+		{"editors/*.go", "editors/rope.go", true},
+		{"editors/*.go", "/src/goedit/editors/rope.go", false},
+		{"/src/*/editors/*.go", "/src/goedit/editors/rope.go", true},
+		{"/src/*.go", "/src/goedit/main.go", false},
+	} {
+		assert.Equal(t, test.want, matchGlobs([]string{test.glob}, test.path), "%s %s", test.glob, test.path)
+	}
+	assert.True(t, matchGlobs([]string{"*.txt", "*.go"}, "main.go"))
+	assert.False(t, matchGlobs(nil, "main.go"))
+}
+
+func TestProjectSearch(t *testing.T) {
+	one, _ := loadTestFile(t, "foo", "bar foo")
+	two, f := loadTestFile(t, "no match")
+	showTestFile(t, one)
+	// the text in the editor is searched, not the file
+	f.InsertText(0, 0, "foo ", CODE_DEFAULT_STYLE)
+
+	ps, err := startProjectSearch("foo", "baz", editors.SearchOptions{}, "", "")
+	assert.NoError(t, err)
+	waitForSearch(ps)
+	results, searched, _ := ps.snapshot()
+	assert.Equal(t, 2, searched)
+	var found []string
+	for _, r := range results {
+		for _, m := range r.matches {
+			found = append(found, r.path+": "+m.replaced)
+		}
+	}
+	assert.ElementsMatch(t, []string{one + ": baz", one + ": bar baz", two + ": baz no match"}, found)
+
+	// both are file.txt
+	ps, err = startProjectSearch("foo", "", editors.SearchOptions{}, "", "*.txt")
+	assert.NoError(t, err)
+	waitForSearch(ps)
+	results, searched, _ = ps.snapshot()
+	assert.Equal(t, 0, searched)
+	assert.Empty(t, results)
+}
+
+// waitForSearch does what the key loop does while a search runs.
+func waitForSearch(ps *projectSearch) {
+	for {
+		if ev, ok := screen.PollEvent().(*tcell.EventInterrupt); ok {
+			if req, ok := ev.Data().(fileTextRequest); ok {
+				req.answer()
+			}
+		}
+		if _, _, done := ps.snapshot(); done {
+			return
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Radisovik/goedit/editors"
+)
+
+// Replacing in files makes one transaction in every file it changes.  Each file
+// keeps its own undo tree, so to undo the lot as one step the states the
+// replace went from and to in every file are remembered: undoing or redoing in
+// one of the files while they all still are where the replace left them does
+// it in all of them.
+
+type replaceStep struct {
+	before map[string]int // state of every file before the replace, by path
+	after  map[string]int // and after it
+	undone bool
+}
+
+// lastReplace is the replace in files made last.
+var lastReplace *replaceStep
+
+// replaceInFiles replaces the matches that weren't rejected and writes the
+// files changed, but for those with unsaved changes of their own, which are
+// left for the user to save.  A match whose text has changed since it was
+// found is left alone.
+func replaceInFiles(results []fileResults, rejected map[hunk]bool) {
+	endTyping()
+	step := &replaceStep{before: make(map[string]int), after: make(map[string]int)}
+	replaced, skipped, unsaved := 0, 0, 0
+	for _, r := range results {
+		f := files[r.path]
+		var accepted []projectMatch
+		for i, m := range r.matches {
+			if rejected[hunk{r.path, i}] {
+				continue
+			}
+			if m.End.Line >= f.Length() || m.End.Column > lineLength(f, m.End.Line) || f.GetText(m.Start, m.End) != m.text {
+				skipped++
+				continue
+			}
+			accepted = append(accepted, m)
+		}
+		if len(accepted) == 0 {
+			continue
+		}
+		step.before[r.path] = currentState(f)
+		modified := isModified(r.path)
+		// from the end, so the matches still to replace don't move
+		f.BeginTransaction(accepted[0].Start)
+		for _, m := range slices.Backward(accepted) {
+			f.ReplaceRange(m.Start, m.End, m.replacement, CODE_DEFAULT_STYLE)
+		}
+		f.EndTransaction(accepted[0].Start)
+		step.after[r.path] = currentState(f)
+		replaced += len(accepted)
+		if modified {
+			unsaved++
+		} else if err := saveFile(r.path); err != nil {
+			statusError(fmt.Errorf("saving %s: %w", r.path, err))
+		}
+	}
+	if len(step.after) > 0 {
+		lastReplace = step
+	}
+	setStatus("Replaced %d matches in %d files, %d skipped as they changed, %d files not saved as they have other unsaved changes",
+		replaced, len(step.after), skipped, unsaved)
+	if editorArea != nil && cursors != nil {
+		syncCursor()
+	}
+}
+
+// undoReplace undoes the last replace in files in every file it changed, if
+// undoing in the file shown would undo it and the others haven't moved on.  As
+// the replace wrote the files without unsaved changes, so does undoing it.
+func undoReplace() bool {
+	if s := lastReplace; s != nil && !s.undone && stepReplace(s.after, s.before) {
+		s.undone = true
+		return true
+	}
+	return false
+}
+
+// redoReplace is undoReplace the other way round.
+func redoReplace() bool {
+	if s := lastReplace; s != nil && s.undone && stepReplace(s.before, s.after) {
+		s.undone = false
+		return true
+	}
+	return false
+}
+
+// stepReplace moves every file from one state to the other.
+func stepReplace(from, to map[string]int) bool {
+	if id, ok := from[currentFile]; !ok || currentState(files[currentFile]) != id {
+		return false
+	}
+	for path, id := range from {
+		if currentState(files[path]) != id {
+			logf("%s changed since the replace in files, only %s is changed", path, currentFile)
+			return false
+		}
+	}
+	endTyping()
+	for path := range from {
+		modified := isModified(path)
+		pos, _ := files[path].GotoState(to[path])
+		if path == currentFile {
+			setCursor(pos.Column, pos.Line)
+		}
+		if modified {
+			continue
+		}
+		if err := saveFile(path); err != nil {
+			statusError(fmt.Errorf("saving %s: %w", path, err))
+		}
+	}
+	return true
+}
+
+// currentState returns the id of the state of the undo tree a file is in.
+func currentState(e editors.Editor) int {
+	for _, s := range e.History() {
+		if s.Current {
+			return s.ID
+		}
+	}
+	return -1
+}
+
+func lineLength(e editors.Editor, line int) int {
+	runes, _ := e.GetLine(line)
+	return len(runes)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplaceInFilesKeepsUnsavedChanges(t *testing.T) {
+	clean, _ := loadTestFile(t, "foo bar")
+	dirty, f := loadTestFile(t, "foo")
+	f.InsertText(0, 3, " unsaved", CODE_DEFAULT_STYLE)
+	t.Cleanup(func() { lastReplace = nil })
+
+	foo := []projectMatch{{
+		Match:       editors.Match{Start: editors.Position{}, End: editors.Position{Column: 3}},
+		text:        "foo",
+		replacement: "baz",
+	}}
+	replaceInFiles([]fileResults{{clean, foo}, {dirty, foo}}, nil)
+	assertFile(t, clean, "baz bar\n")
+	assertFile(t, dirty, "foo\n")
+	assert.Equal(t, []string{"baz unsaved"}, editorLines(f))
+	assert.True(t, isModified(dirty))
+
+	// nor does undoing the replace write them
+	showTestFile(t, clean)
+	assert.True(t, undoReplace())
+	assertFile(t, clean, "foo bar\n")
+	assertFile(t, dirty, "foo\n")
+	assert.Equal(t, []string{"foo unsaved"}, editorLines(f))
+}
+
+func assertFile(t *testing.T, filePath, content string) {
+	t.Helper()
+	data, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	assert.Equal(t, content, string(data))
+}
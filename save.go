@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// saveFile writes a loaded file to disk and marks it clean.
+func saveFile(filePath string) error {
+	f, ok := files[filePath]
+	if !ok {
+		return fmt.Errorf("%s isn't loaded", filePath)
+	}
+	if filePath == currentFile {
+		endTyping()
+	}
+	data, err := encodeFile(f, fileInfos[filePath].format)
+	if err != nil {
+		return err
+	}
+	inPlace, err := writeFileAtomic(filePath, data)
+	if err != nil {
+		return err
+	}
+	if inPlace {
+		logf("%s belongs to someone else, it was written in place rather than replaced", filePath)
+	}
+	f.MarkSaved()
+	info := fileInfos[filePath]
+	info.inPlace = inPlace
+	info.saved = info.format
+	info.disk = sha256.Sum256(data)
+	info.base = editorLines(f)
+	info.savedHash = linesHash(info.base)
+	resetJournal(filePath)
+	return nil
+}
+
+// saveCurrentFile saves the file shown in the editor area.
+func saveCurrentFile() {
+	if currentFile == "" {
+		setStatus("No file to save")
+		return
+	}
+	if err := saveFile(currentFile); err != nil {
+		statusError(fmt.Errorf("saving %s: %w", currentFile, err))
+		return
+	}
+	if fileInfos[currentFile].inPlace {
+		setStatus("Saved %s, but not atomically: it belongs to someone else, so it was written in place", currentFile)
+		return
+	}
+	setStatus("Saved %s", currentFile)
+}
+
+// isModified reports whether a loaded file has changes that aren't saved, to
+// its text or to its format.
+func isModified(filePath string) bool {
+	info := fileInfos[filePath]
+	return files[filePath].Modified() || (info != nil && info.format != info.saved)
+}
+
+// modifiedFiles returns the loaded files with unsaved changes, in order.
+func modifiedFiles() []string {
+	var rtn []string
+	for name := range files {
+		if isModified(name) {
+			rtn = append(rtn, name)
+		}
+	}
+	slices.Sort(rtn)
+	return rtn
+}
+
+// writeFileAtomic replaces the file at path with data so that, whatever
+// happens, the file holds either its old or its new content: the data goes to
+// a temporary file next to it which is then renamed over it.  The new file
+// gets the mode and owner of the old one.  A symbolic link is followed, the
+// file it points to is replaced.  A file whose owner the new one can't be given
+// is written in place instead, inPlace reports that.
+func writeFileAtomic(path string, data []byte) (inPlace bool, err error) {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	mode := os.FileMode(0644)
+	info, err := os.Stat(path)
+	if err == nil {
+		mode = info.Mode() & (os.ModePerm | os.ModeSetgid | os.ModeSticky)
+	} else if !os.IsNotExist(err) {
+		return false, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".goedit-*")
+	if err != nil {
+		return false, err
+	}
+	done := false
+	defer func() {
+		if !done {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if info != nil {
+		if err := chown(tmp, info); err != nil {
+			// a file of someone else's can only be written in place
+			return true, writeInPlace(path, data)
+		}
+	}
+	// after the chown, which clears setgid
+	if err := tmp.Chmod(mode); err != nil {
+		return false, err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return false, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return false, err
+	}
+	if err := tmp.Close(); err != nil {
+		return false, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, err
+	}
+	done = true
+	// make the rename itself durable
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return false, nil
+}
+
+func writeInPlace(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
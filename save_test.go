@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// assertNoTempFiles checks that no temporary file of writeFileAtomic is left
+// in dir.
+func assertNoTempFiles(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.NotContains(t, entry.Name(), ".goedit-")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.txt")
+
+	inPlace, err := writeFileAtomic(path, []byte("new\n"))
+	assert.NoError(t, err)
+	assert.False(t, inPlace)
+	assertFile(t, path, "new\n")
+
+	inPlace, err = writeFileAtomic(path, []byte("replaced\n"))
+	assert.NoError(t, err)
+	assert.False(t, inPlace)
+	assertFile(t, path, "replaced\n")
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteFileAtomicKeepsMode(t *testing.T) {
+	for _, mode := range []os.FileMode{0600, 0755, 0640 | os.ModeSetgid, 0644 | os.ModeSticky} {
+		t.Run(mode.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "file.txt")
+			assert.NoError(t, os.WriteFile(path, []byte("old\n"), 0600))
+			assert.NoError(t, os.Chmod(path, mode))
+			// what the file system lets us have
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			want := info.Mode()
+
+			_, err = writeFileAtomic(path, []byte("new\n"))
+			assert.NoError(t, err)
+			info, err = os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, want, info.Mode())
+			assertFile(t, path, "new\n")
+			assertNoTempFiles(t, dir)
+		})
+	}
+}
+
+func TestWriteFileAtomicFollowsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target.txt")
+	link := filepath.Join(dir, "link.txt")
+	assert.NoError(t, os.WriteFile(target, []byte("old\n"), 0644))
+	if err := os.Symlink("target.txt", link); err != nil {
+		t.Skip("no symbolic links:", err)
+	}
+
+	_, err := writeFileAtomic(link, []byte("new\n"))
+	assert.NoError(t, err)
+	info, err := os.Lstat(link)
+	assert.NoError(t, err)
+	assert.Equal(t, os.ModeSymlink, info.Mode()&os.ModeSymlink)
+	assertFile(t, target, "new\n")
+	assertNoTempFiles(t, dir)
+}
+
+func TestWriteFileAtomicError(t *testing.T) {
+	// a directory can't be replaced by a file, nothing is left behind
+	dir := t.TempDir()
+	path := filepath.Join(dir, "sub")
+	assert.NoError(t, os.Mkdir(path, 0755))
+	_, err := writeFileAtomic(path, []byte("new\n"))
+	assert.Error(t, err)
+	assertNoTempFiles(t, dir)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/gdamore/tcell/v2"
+)
+
+var MATCH_STYLE = tcell.Style{}.Foreground(tcell.ColorBlack).Background(tcell.ColorYellow)
+
+// searchPanel is the incremental find prompt.  It is drawn on the line above
+// the log so the editor area stays visible, the matches in it are highlighted
+// and the first one from where the search started is selected as the text is
+// typed.
+type searchPanel struct {
+	text    []rune
+	options editors.SearchOptions
+	search  *editors.Search
+	err     error
+	found   bool
+
+	origin editors.Position    // where the search started
+	saved  []editors.Selection // the cursors to put back on Escape, primary last
+}
+
+func openSearchPanel() {
+	primary := cursors.Primary()
+	saved := slices.DeleteFunc(cursors.Selections(), func(sel editors.Selection) bool { return sel == primary })
+	start, _ := primary.Range()
+	activePanel = &searchPanel{origin: start, saved: append(saved, primary)}
+}
+
+func (p *searchPanel) draw() {
+	width, _ := screen.Size()
+	y := statusLineY()
+	toggle := func(on bool) string {
+		if on {
+			return "x"
+		}
+		return " "
+	}
+	status := ""
+	switch {
+	case p.err != nil:
+		status = p.err.Error()
+	case len(p.text) > 0 && !p.found:
+		status = "no match"
+	}
+	prompt := fmt.Sprintf(" Find: %s", string(p.text))
+	drawText(0, y, PANEL_STYLE, "%-*s", width, fmt.Sprintf("%s   [%s] case Alt+C  [%s] word Alt+W  [%s] regex Alt+R  Up/Down previous/next  %s",
+		prompt, toggle(p.options.CaseSensitive), toggle(p.options.WholeWord), toggle(p.options.Regexp), status))
+	screen.ShowCursor(len([]rune(prompt)), y)
+}
+
+func (p *searchPanel) handleKey(ev *tcell.EventKey) bool {
+	alt := ev.Modifiers()&tcell.ModAlt != 0
+	switch {
+	case ev.Key() == tcell.KeyEscape:
+		cursors.Set(p.saved)
+		return p.close()
+	case ev.Key() == tcell.KeyEnter:
+		return p.close()
+	case ev.Key() == tcell.KeyDown || ev.Key() == tcell.KeyCtrlN:
+		p.next(cursors.Primary().Head, false)
+	case ev.Key() == tcell.KeyUp || ev.Key() == tcell.KeyCtrlP:
+		start, _ := cursors.Primary().Range()
+		p.next(start, true)
+	case ev.Key() == tcell.KeyBackspace || ev.Key() == tcell.KeyBackspace2:
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+			p.update()
+		}
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'c' || ev.Rune() == 'C'):
+		p.options.CaseSensitive = !p.options.CaseSensitive
+		p.update()
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'w' || ev.Rune() == 'W'):
+		p.options.WholeWord = !p.options.WholeWord
+		p.update()
+	case ev.Key() == tcell.KeyRune && alt && (ev.Rune() == 'r' || ev.Rune() == 'R'):
+		p.options.Regexp = !p.options.Regexp
+		p.update()
+	case ev.Key() == tcell.KeyRune:
+		p.text = append(p.text, ev.Rune())
+		p.update()
+	}
+	return true
+}
+
+// update searches again from the start after the text or an option changed.
+func (p *searchPanel) update() {
+	p.search, p.err = nil, nil
+	if len(p.text) > 0 {
+		p.search, p.err = editors.NewSearch(string(p.text), p.options)
+	}
+	editorArea.search = p.search
+	if !p.next(p.origin, false) {
+		cursors.Set(p.saved)
+	}
+}
+
+// next selects the match after, or before, from and reports whether there was
+// one.
+func (p *searchPanel) next(from editors.Position, backward bool) bool {
+	p.found = false
+	if p.search != nil {
+		var m editors.Match
+		if m, p.found = p.search.Next(editorArea.content, from, backward); p.found {
+			cursors.Set([]editors.Selection{{Head: m.End, Tail: m.Start}})
+		}
+	}
+	return p.found
+}
+
+func (p *searchPanel) close() bool {
+	editorArea.search = nil
+	syncCursor()
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+var STATUS_STYLE = tcell.Style{}.Foreground(tcell.ColorBlack).Background(tcell.ColorLightGray)
+var STATUS_ERROR_STYLE = tcell.Style{}.Foreground(tcell.ColorWhite).Background(tcell.ColorDarkRed)
+
+// statusMessage is shown on the status line until the next one, it also goes
+// to the log.
+var statusMessage = ""
+var statusIsError = false
+
+func setStatus(format string, args ...any) {
+	statusMessage = fmt.Sprintf(format, args...)
+	statusIsError = false
+	logf("%s", statusMessage)
+}
+
+func statusError(err error) {
+	statusMessage = "Error " + err.Error()
+	statusIsError = true
+	logf("%s", statusMessage)
+}
+
+// statusLineY is the screen line of the status line, right above the log.
+func statusLineY() int {
+	_, height := screen.Size()
+	return height - NUM_LOG_LINES - 1
+}
+
+// drawStatusLine shows the file in the editor area, where the cursor is and
+// the latest message.
+func drawStatusLine() {
+	width, _ := screen.Size()
+	name := currentFile
+	if name == "" {
+		name = "[no file]"
+	}
+	left := fmt.Sprintf(" %s  %d:%d ", name, cy+1, cx+1)
+	right := ""
+	if info, ok := fileInfos[currentFile]; ok {
+		right = info.format.describe() + " "
+	}
+	drawText(0, statusLineY(), STATUS_STYLE, "%-*s%s", max(0, width-len([]rune(right))), left, right)
+	style := STATUS_STYLE
+	if statusIsError {
+		style = STATUS_ERROR_STYLE
+	}
+	drawText(len([]rune(left))+1, statusLineY(), style, " %s ", statusMessage)
+}
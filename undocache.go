@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/Radisovik/goedit/editors"
+)
+
+// The undo history of every file is kept in the user's cache directory when
+// goedit exits, in a file named after the hash of the file's absolute path.
+// The history is written as of the text last saved, so edits thrown away when
+// quitting can be redone, and next to it goes the hash of that text.  The
+// history is only brought back if the file still holds it.
+
+type undoCacheEntry struct {
+	Path    string
+	Hash    string
+	History json.RawMessage
+}
+
+// undoCachePath returns where the undo history of filePath is kept.
+func undoCachePath(filePath string) (string, error) {
+	return cachePath("undo", filePath, ".json")
+}
+
+// cachePath returns the file in the kind directory of goedit's cache that
+// belongs to filePath.
+func cachePath(kind, filePath, ext string) (string, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(abs))
+	return filepath.Join(dir, "goedit", kind, hex.EncodeToString(sum[:])+ext), nil
+}
+
+// linesHash hashes text as an editor holds it, every line ended by a newline.
+func linesHash(lines []string) string {
+	h := sha256.New()
+	for _, line := range lines {
+		h.Write([]byte(line))
+		h.Write([]byte{'\n'})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func textHash(e editors.Editor) string {
+	return linesHash(editorLines(e))
+}
+
+// saveUndoHistory writes the undo history of the editor holding filePath.  A
+// file nobody edited has nothing to keep, any history left from before is
+// removed instead.
+func saveUndoHistory(filePath string, e editors.Editor) error {
+	path, err := undoCachePath(filePath)
+	if err != nil {
+		return err
+	}
+	if len(e.History()) <= 1 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var history bytes.Buffer
+	if err := e.WriteHistory(&history); err != nil {
+		return err
+	}
+	abs, _ := filepath.Abs(filePath)
+	data, err := json.Marshal(undoCacheEntry{Path: abs, Hash: fileInfos[filePath].savedHash, History: history.Bytes()})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// loadUndoHistory gives the editor just loaded from filePath the undo history
+// saved for it, if there is one and the file hasn't changed since.
+func loadUndoHistory(filePath string, e editors.Editor) (bool, error) {
+	path, err := undoCachePath(filePath)
+	if err != nil {
+		return false, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var entry undoCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return false, err
+	}
+	if entry.Hash != textHash(e) {
+		return false, nil
+	}
+	return true, e.ReadHistory(bytes.NewReader(entry.History))
+}
+
+func saveUndoHistories() {
+	for name, f := range files {
+		if err := saveUndoHistory(name, f); err != nil {
+			logf("Error saving undo history of %s: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Radisovik/goedit/editors"
+	"github.com/stretchr/testify/assert"
+)
+
+// reloadTestFile loads a file again the way loadFile does after a restart,
+// with the undo history saved for it.
+func reloadTestFile(t *testing.T, filePath string) (editors.Editor, bool) {
+	t.Helper()
+	content, err := os.ReadFile(filePath)
+	assert.NoError(t, err)
+	lines, _, err := decodeFile(content)
+	assert.NoError(t, err)
+	f := newTestEditor(lines)
+	f.ClearHistory()
+	loaded, err := loadUndoHistory(filePath, f)
+	assert.NoError(t, err)
+	return f, loaded
+}
+
+func TestSaveUndoHistory(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	path, err := undoCachePath(filePath)
+	assert.NoError(t, err)
+
+	// a file that wasn't edited leaves nothing in the cache
+	saveUndoHistories()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	f.InsertText(0, 3, "!", CODE_DEFAULT_STYLE)
+	assert.NoError(t, saveFile(filePath))
+	saveUndoHistories()
+	again, loaded := reloadTestFile(t, filePath)
+	assert.True(t, loaded)
+	_, ok := again.Undo()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"one"}, editorLines(again))
+
+	// nor does one whose history was cleared, the old history goes
+	f.ClearHistory()
+	saveUndoHistories()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestUndoHistoryAfterDiscarding(t *testing.T) {
+	filePath, f := loadTestFile(t, "one")
+	f.InsertText(0, 3, "!", CODE_DEFAULT_STYLE)
+	assert.NoError(t, saveFile(filePath))
+	f.InsertText(0, 4, " unsaved", CODE_DEFAULT_STYLE)
+
+	// quitting without saving leaves the file as it was saved
+	saveUndoHistories()
+	again, loaded := reloadTestFile(t, filePath)
+	assert.True(t, loaded)
+	assert.Equal(t, []string{"one!"}, editorLines(again))
+	assert.False(t, again.Modified())
+
+	// the saved edit can be undone, the thrown away one redone
+	_, ok := again.Undo()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"one"}, editorLines(again))
+	again.Redo()
+	_, ok = again.Redo()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"one! unsaved"}, editorLines(again))
+
+	// nothing saved at all, the history starts from the text as it was loaded
+	filePath, f = loadTestFile(t, "two")
+	f.InsertText(0, 0, "unsaved ", CODE_DEFAULT_STYLE)
+	saveUndoHistories()
+	again, loaded = reloadTestFile(t, filePath)
+	assert.True(t, loaded)
+	_, ok = again.Redo()
+	assert.True(t, ok)
+	assert.Equal(t, []string{"unsaved two"}, editorLines(again))
+}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"github.com/gdamore/tcell/v2"
+	"golang.org/x/sys/unix"
+)
+
+// The directories of the loaded files are watched with inotify rather than the
+// files themselves: a file replaced by renaming another one over it, the way
+// goedit and most tools save, would drop its watch.
+
+const WATCH_EVENTS = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_DELETE | unix.IN_MOVED_FROM
+
+type fileWatcher struct {
+	fd    int
+	mu    sync.Mutex
+	dirs  map[int]string    // directory by watch descriptor
+	paths map[string]string // files map key by absolute path
+}
+
+var watcher *fileWatcher
+
+// watchFile makes changes to a loaded file on disk be posted to the key loop
+// as a fileChanged event.
+func watchFile(filePath string) error {
+	if watcher == nil {
+		fd, err := unix.InotifyInit1(unix.IN_CLOEXEC)
+		if err != nil {
+			return err
+		}
+		watcher = &fileWatcher{fd: fd, dirs: make(map[int]string), paths: make(map[string]string)}
+		go watcher.run()
+	}
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return err
+	}
+	wd, err := unix.InotifyAddWatch(watcher.fd, filepath.Dir(abs), WATCH_EVENTS)
+	if err != nil {
+		return err
+	}
+	watcher.mu.Lock()
+	defer watcher.mu.Unlock()
+	watcher.dirs[wd] = filepath.Dir(abs)
+	watcher.paths[abs] = filePath
+	return nil
+}
+
+func (w *fileWatcher) run() {
+	buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+	for {
+		n, err := unix.Read(w.fd, buf)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			backgroundLogf("Error watching files: %v", err)
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			name := buf[offset+unix.SizeofInotifyEvent : offset+unix.SizeofInotifyEvent+int(event.Len)]
+			offset += unix.SizeofInotifyEvent + int(event.Len)
+			// the name is padded with NULs
+			for len(name) > 0 && name[len(name)-1] == 0 {
+				name = name[:len(name)-1]
+			}
+			w.mu.Lock()
+			path, ok := w.paths[filepath.Join(w.dirs[int(event.Wd)], string(name))]
+			w.mu.Unlock()
+			if ok {
+				screen.PostEvent(tcell.NewEventInterrupt(fileChanged(path)))
+			}
+		}
+	}
+}
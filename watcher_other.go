@@ -0,0 +1,9 @@
+//go:build !linux
+
+package main
+
+// watchFile does nothing where there is no inotify, changes made to files on
+// disk go unnoticed.
+func watchFile(filePath string) error {
+	return nil
+}